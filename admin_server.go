@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// adminShutdownTimeout is how long in-flight admin requests are given to complete when the bridge stops.
+const adminShutdownTimeout = 5 * time.Second
+
+// adminServer serves the healthchecks and the operational endpoints of the bridge, or its control endpoints, on its own listener.
+type adminServer struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+// newAdminServer starts listening on the address straight away, so that a port which is already taken fails the bridge on startup.
+// With a TLS config the server serves HTTPS.
+func newAdminServer(address string, readTimeout time.Duration, writeTimeout time.Duration, tlsConfig *tls.Config, handler http.Handler) (*adminServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	return &adminServer{
+		server: &http.Server{
+			Handler:      handler,
+			ReadTimeout:  readTimeout,
+			WriteTimeout: writeTimeout,
+		},
+		listener: listener,
+	}, nil
+}
+
+// serve blocks until the server is shut down, returning any other failure of the listener.
+func (s *adminServer) serve() error {
+	if err := s.server.Serve(s.listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// shutdown stops accepting connections and waits for the in-flight requests until the timeout.
+func (s *adminServer) shutdown(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+func (s *adminServer) address() string {
+	return s.listener.Addr().String()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminServerServesUntilShutdown(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	server, err := newAdminServer("127.0.0.1:0", time.Second, time.Second, nil, handler)
+	assert.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.serve()
+	}()
+
+	resp, err := http.Get("http://" + server.address() + "/__gtg")
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "OK", string(body))
+
+	assert.NoError(t, server.shutdown(time.Second))
+	select {
+	case err := <-served:
+		assert.NoError(t, err, "A shut down server is not a failure")
+	case <-time.After(time.Second):
+		t.Fatal("Server did not stop after shutdown")
+	}
+}
+
+func TestAdminServerFailsWhenAddressIsTaken(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	_, err = newAdminServer(listener.Addr().String(), time.Second, time.Second, nil, http.NewServeMux())
+	assert.Error(t, err)
+}
+
+func TestAdminRouter(t *testing.T) {
+	bridge := newBridgeApp("http://localhost:8080", "kafka-bridge", "largest", false, "", "NativeCmsPublicationEvents", "http://cms-notifier:8080", "", plainHTTP, "kafka-bridge", producerSettings{})
+	bridge.healthCheckInterval = time.Minute
+	bridge.healthCheckTimeout = time.Millisecond
+	bridge.liveness = newLivenessMonitor(time.Minute, bridge.consumerObserver.lastRequestTime, systemClock{})
+	router := bridge.adminRouter()
+
+	for _, path := range []string{"/__health", "/__build-info", "/__live"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com"+path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+
+	for _, path := range []string{"/__metrics", "/__status", "/__unknown"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com"+path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
+
+func TestControlRouterRequiresAuthentication(t *testing.T) {
+	bridge := newBridgeApp("http://localhost:8080", "kafka-bridge", "largest", false, "", "NativeCmsPublicationEvents", "http://cms-notifier:8080", "", plainHTTP, "kafka-bridge", producerSettings{})
+	bridge.liveness = newLivenessMonitor(time.Minute, bridge.consumerObserver.lastRequestTime, systemClock{})
+	bridge.controlAuth = bearerTokenAuthenticator{token: []byte("s3cr3t")}
+	control := bridge.controlRouter()
+
+	var tests = []struct {
+		path           string
+		authorization  string
+		expectedStatus int
+	}{
+		{"/__metrics", "", http.StatusUnauthorized},
+		{"/__metrics", "Bearer s3cr3t", http.StatusOK},
+		{"/__status", "", http.StatusUnauthorized},
+		{"/__status", "Bearer wrong", http.StatusUnauthorized},
+		{"/__status", "Bearer s3cr3t", http.StatusOK},
+		{"/debug/gc", "Bearer s3cr3t", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "http://example.com"+test.path, nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		w := httptest.NewRecorder()
+		control.ServeHTTP(w, req)
+		assert.Equal(t, test.expectedStatus, w.Code, test.path+" "+test.authorization)
+	}
+}
+
+func TestDiagnosticsAreOnlyServedOnTheControlRouter(t *testing.T) {
+	bridge := newBridgeApp("http://localhost:8080", "kafka-bridge", "largest", false, "", "NativeCmsPublicationEvents", "http://cms-notifier:8080", "", plainHTTP, "kafka-bridge", producerSettings{})
+	bridge.healthCheckInterval = time.Minute
+	bridge.healthCheckTimeout = time.Millisecond
+	bridge.liveness = newLivenessMonitor(time.Minute, bridge.consumerObserver.lastRequestTime, systemClock{})
+	bridge.diagnosticsEnabled = true
+	bridge.controlAuth = bearerTokenAuthenticator{token: []byte("s3cr3t")}
+
+	w := httptest.NewRecorder()
+	bridge.adminRouter().ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/debug/gc", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	control := bridge.controlRouter()
+	w = httptest.NewRecorder()
+	control.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/debug/gc", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest("GET", "http://example.com/debug/gc", nil)
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	w = httptest.NewRecorder()
+	control.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSplitNonEmpty(t *testing.T) {
+	assert.Nil(t, splitNonEmpty(""))
+	assert.Equal(t, []string{"ops", "sre"}, splitNonEmpty(" ops,,sre "))
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+)
+
+// proxyBatchConfig limits how many messages are posted to kafka-proxy in one request.
+// A batch is flushed as soon as any of the limits is reached. Up to MaxInFlight batches are posted at the same time.
+type proxyBatchConfig struct {
+	MaxMessages int
+	MaxBytes    int
+	Linger      time.Duration
+	MaxInFlight int
+}
+
+type batchingProxyProducer struct {
+	config       queueProducer.MessageProducerConfig
+	batchConfig  proxyBatchConfig
+	client       plainHttpClient
+	connectivity queueProducer.MessageProducer
+	records      chan *batchRecord
+	inFlight     chan struct{}
+	posting      sync.WaitGroup
+	stopping     chan struct{}
+	stopped      chan struct{}
+}
+
+type batchRecord struct {
+	tid    string
+	value  string
+	result chan error
+}
+
+type proxyRecords struct {
+	Records []proxyRecord `json:"records"`
+}
+
+type proxyRecord struct {
+	Value string `json:"value"`
+}
+
+type proxyOffsets struct {
+	Offsets []proxyOffset `json:"offsets"`
+}
+
+type proxyOffset struct {
+	Partition *int    `json:"partition"`
+	Offset    *int64  `json:"offset"`
+	ErrorCode *int    `json:"error_code"`
+	Error     *string `json:"error"`
+}
+
+func init() {
+	registerProducer(producerFactory{
+		Name:        proxy,
+		Description: "Writes every message to -topic through the kafka-proxy at -producer_address, in batches when -producer_batch_max_messages is greater than 1.",
+		Settings: []producerSetting{
+			{Flag: "producer_address", Required: true},
+			{Flag: "topic", Required: true},
+			{Flag: "producer_vulcan_auth"},
+			{Flag: "producer_batch_max_messages"},
+			{Flag: "producer_batch_max_bytes"},
+			{Flag: "producer_batch_linger"},
+			{Flag: "producer_batch_max_in_flight"},
+		},
+		Flags: func(flags *flag.FlagSet) interface{} {
+			batch := &proxyBatchConfig{}
+			flags.IntVar(&batch.MaxMessages, "producer_batch_max_messages", 1, "Maximum number of messages posted to kafka-proxy in one request. Batching is enabled for the proxy producer when greater than 1.")
+			flags.IntVar(&batch.MaxBytes, "producer_batch_max_bytes", 1024*1024, "Maximum size in bytes of the encoded messages posted to kafka-proxy in one request.")
+			flags.DurationVar(&batch.Linger, "producer_batch_linger", 100*time.Millisecond, "Maximum time a message waits for its batch to fill up before it is posted to kafka-proxy.")
+			flags.IntVar(&batch.MaxInFlight, "producer_batch_max_in_flight", 4, "Maximum number of batches posted to kafka-proxy at the same time.")
+			return batch
+		},
+		New: func(settings producerSettings) (queueProducer.MessageProducer, error) {
+			if err := requireAddress(proxy, settings); err != nil {
+				return nil, err
+			}
+			if settings.Config.Topic == "" {
+				return nil, errors.New("Producer type proxy requires -topic")
+			}
+			if batch, ok := settings.Options[proxy].(*proxyBatchConfig); ok && batch.MaxMessages > 1 {
+				return newBatchingProxyProducer(settings.Config, *batch), nil
+			}
+			return queueProducer.NewMessageProducer(settings.Config), nil
+		},
+	})
+}
+
+// checkBatchWorkers rejects batching with a single worker: SendMessage returns once the batch of the message is posted,
+// so a single worker would wait for -producer_batch_linger on every message.
+func checkBatchWorkers(batch proxyBatchConfig, workerCount int) error {
+	if batch.MaxMessages > 1 && workerCount < 2 {
+		return fmt.Errorf("-producer_batch_max_messages=%d requires -worker_count greater than 1, a single worker would wait for -producer_batch_linger on every message", batch.MaxMessages)
+	}
+	return nil
+}
+
+// newBatchingProxyProducer returns a producer which writes messages to kafka through kafka-proxy, collecting the messages
+// sent concurrently into a single multi-record request.
+func newBatchingProxyProducer(config queueProducer.MessageProducerConfig, batchConfig proxyBatchConfig) queueProducer.MessageProducer {
+	if batchConfig.MaxMessages < 1 {
+		batchConfig.MaxMessages = 1
+	}
+	if batchConfig.MaxBytes <= 0 {
+		batchConfig.MaxBytes = int(^uint(0) >> 1)
+	}
+	if batchConfig.MaxInFlight < 1 {
+		batchConfig.MaxInFlight = 1
+	}
+	client := &http.Client{
+		Timeout: 60 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: 100,
+			Dial: (&net.Dialer{
+				KeepAlive: 30 * time.Second,
+			}).Dial,
+		}}
+	p := &batchingProxyProducer{
+		config:       config,
+		batchConfig:  batchConfig,
+		client:       client,
+		connectivity: queueProducer.NewMessageProducerWithHTTPClient(config, client),
+		records:      make(chan *batchRecord),
+		inFlight:     make(chan struct{}, batchConfig.MaxInFlight),
+		stopping:     make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+	go p.batchRecords()
+	return p
+}
+
+// SendMessage queues the message for the next batch and blocks until that batch has been posted.
+// The returned error only concerns this message, even if other records of the batch were rejected.
+func (p *batchingProxyProducer) SendMessage(uuid string, message queueProducer.Message) error {
+	record := &batchRecord{
+		tid:    message.Headers["X-Request-Id"],
+		value:  base64.StdEncoding.EncodeToString([]byte((&queueProducer.FTMessage{Headers: message.Headers, Body: message.Body}).Build())),
+		result: make(chan error, 1),
+	}
+	p.records <- record
+	return <-record.result
+}
+
+func (p *batchingProxyProducer) ConnectivityCheck() (string, error) {
+	return p.connectivity.ConnectivityCheck()
+}
+
+// stop posts the batch being collected and waits for the batches in flight. No message can be sent once it is called.
+func (p *batchingProxyProducer) stop() {
+	close(p.stopping)
+	<-p.stopped
+}
+
+// batchRecords collects the records into batches and hands them over to be posted in the background. Once MaxInFlight
+// batches are being posted, it waits for one of them to complete, so that the senders block instead of piling up batches.
+func (p *batchingProxyProducer) batchRecords() {
+	var batch []*batchRecord
+	var batchBytes int
+	var linger <-chan time.Time
+
+	flush := func() {
+		p.inFlight <- struct{}{}
+		p.posting.Add(1)
+		go func(batch []*batchRecord) {
+			defer p.posting.Done()
+			p.postBatch(batch)
+			<-p.inFlight
+		}(batch)
+		batch = nil
+		batchBytes = 0
+		linger = nil
+	}
+
+	for {
+		select {
+		case record := <-p.records:
+			if len(batch) > 0 && batchBytes+len(record.value) > p.batchConfig.MaxBytes {
+				flush()
+			}
+			batch = append(batch, record)
+			batchBytes += len(record.value)
+			if len(batch) >= p.batchConfig.MaxMessages || batchBytes >= p.batchConfig.MaxBytes {
+				flush()
+			} else if linger == nil {
+				linger = time.After(p.batchConfig.Linger)
+			}
+		case <-linger:
+			flush()
+		case <-p.stopping:
+			if len(batch) > 0 {
+				flush()
+			}
+			p.posting.Wait()
+			close(p.stopped)
+			return
+		}
+	}
+}
+
+func (p *batchingProxyProducer) postBatch(batch []*batchRecord) {
+	errs := p.sendBatch(batch)
+	for i, record := range batch {
+		record.result <- errs[i]
+	}
+}
+
+// sendBatch posts the records and returns one error per record, in the order the records were sent.
+func (p *batchingProxyProducer) sendBatch(batch []*batchRecord) []error {
+	errs := make([]error, len(batch))
+	failAll := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	payload := proxyRecords{Records: make([]proxyRecord, len(batch))}
+	for i, record := range batch {
+		payload.Records[i] = proxyRecord{Value: record.value}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return failAll(fmt.Errorf("Error encoding batch of %d records: %v", len(batch), err.Error()))
+	}
+
+	req, err := http.NewRequest("POST", p.config.Addr+"/topics/"+p.config.Topic, bytes.NewReader(body))
+	if err != nil {
+		return failAll(fmt.Errorf("Error creating new request: %v", err.Error()))
+	}
+	req.Header.Add("Content-Type", "application/vnd.kafka.binary.v1+json")
+	if len(p.config.Queue) > 0 {
+		req.Host = p.config.Queue
+	}
+	if len(p.config.Authorization) > 0 {
+		req.Header.Add("Authorization", p.config.Authorization)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return failAll(fmt.Errorf("Error executing POST request to kafka-proxy: %v", err.Error()))
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return failAll(&httpStatusError{
+			StatusCode: resp.StatusCode,
+			message:    fmt.Sprintf("Forwarding batch of %d records is not successful. Status: %d", len(batch), resp.StatusCode),
+		})
+	}
+
+	offsets := proxyOffsets{}
+	if err := json.NewDecoder(resp.Body).Decode(&offsets); err != nil {
+		return failAll(fmt.Errorf("Error decoding kafka-proxy response: %v", err.Error()))
+	}
+
+	for i, record := range batch {
+		if i >= len(offsets.Offsets) {
+			errs[i] = fmt.Errorf("Forwarding message with tid: %s is not confirmed by kafka-proxy", record.tid)
+			continue
+		}
+		offset := offsets.Offsets[i]
+		if offset.Error != nil || offset.ErrorCode != nil {
+			errs[i] = errors.New(proxyRecordError(record.tid, offset))
+		}
+	}
+	return errs
+}
+
+func proxyRecordError(tid string, offset proxyOffset) string {
+	msg := fmt.Sprintf("Forwarding message with tid: %s is not successful.", tid)
+	if offset.ErrorCode != nil {
+		msg += fmt.Sprintf(" Error code: %d.", *offset.ErrorCode)
+	}
+	if offset.Error != nil {
+		msg += " " + *offset.Error
+	}
+	return msg
+}
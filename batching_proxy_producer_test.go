@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchingProducerPostsConcurrentMessagesTogether(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []proxyRecords
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/topics/NativeCmsMetadataPublicationEvents", r.URL.Path)
+		assert.Equal(t, "application/vnd.kafka.binary.v1+json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "authorizationkey", r.Header.Get("Authorization"))
+
+		records := proxyRecords{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&records))
+		mutex.Lock()
+		requests = append(requests, records)
+		mutex.Unlock()
+
+		offsets := make([]string, len(records.Records))
+		for i := range offsets {
+			offsets[i] = fmt.Sprintf(`{"partition":0,"offset":%d,"error_code":null,"error":null}`, i)
+		}
+		fmt.Fprintf(w, `{"offsets":[%s]}`, strings.Join(offsets, ","))
+	}))
+	defer server.Close()
+
+	p := newBatchingProxyProducer(queueProducer.MessageProducerConfig{
+		Addr:          server.URL,
+		Topic:         "NativeCmsMetadataPublicationEvents",
+		Authorization: "authorizationkey",
+	}, proxyBatchConfig{MaxMessages: 3, MaxBytes: 1024 * 1024, Linger: time.Minute})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := p.SendMessage("", queueProducer.Message{
+				Headers: map[string]string{"X-Request-Id": fmt.Sprintf("tid_%d", i)},
+				Body:    `{"uuid":"7543220a-2389-11e5-bd83-71cb60e8f08c"}`,
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, requests, 1, "All messages should be posted in one request")
+	assert.Len(t, requests[0].Records, 3)
+
+	value, err := base64.StdEncoding.DecodeString(requests[0].Records[0].Value)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(value), "FTMSG/1.0\nX-Request-Id: tid_"))
+	assert.True(t, strings.HasSuffix(string(value), "\n\n"+`{"uuid":"7543220a-2389-11e5-bd83-71cb60e8f08c"}`))
+}
+
+func TestBatchingProducerFlushesAfterLinger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1,"error_code":null,"error":null}]}`))
+	}))
+	defer server.Close()
+
+	p := newBatchingProxyProducer(queueProducer.MessageProducerConfig{Addr: server.URL, Topic: "topic"},
+		proxyBatchConfig{MaxMessages: 100, Linger: 10 * time.Millisecond})
+
+	err := p.SendMessage("", queueProducer.Message{Headers: map[string]string{"X-Request-Id": "tid_1"}, Body: "body"})
+	assert.NoError(t, err)
+}
+
+func TestBatchingProducerMapsRecordErrorsToTIDs(t *testing.T) {
+	batch := []*batchRecord{{tid: "tid_ok", value: "a"}, {tid: "tid_rejected", value: "b"}, {tid: "tid_unconfirmed", value: "c"}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1,"error_code":null,"error":null},{"partition":null,"offset":null,"error_code":50002,"error":"Kafka error"}]}`))
+	}))
+	defer server.Close()
+
+	p := newBatchingProxyProducer(queueProducer.MessageProducerConfig{Addr: server.URL, Topic: "topic"}, proxyBatchConfig{}).(*batchingProxyProducer)
+	errs := p.sendBatch(batch)
+
+	assert.NoError(t, errs[0])
+	assert.EqualError(t, errs[1], "Forwarding message with tid: tid_rejected is not successful. Error code: 50002. Kafka error")
+	assert.EqualError(t, errs[2], "Forwarding message with tid: tid_unconfirmed is not confirmed by kafka-proxy")
+}
+
+func TestBatchingProducerFailsWholeBatchOnBadStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	p := newBatchingProxyProducer(queueProducer.MessageProducerConfig{Addr: server.URL, Topic: "topic"}, proxyBatchConfig{}).(*batchingProxyProducer)
+	errs := p.sendBatch([]*batchRecord{{tid: "tid_1", value: "a"}, {tid: "tid_2", value: "b"}})
+
+	for _, err := range errs {
+		assert.EqualError(t, err, "Forwarding batch of 2 records is not successful. Status: 503")
+	}
+}
+
+func TestBatchingProducerPostsBatchesConcurrently(t *testing.T) {
+	var mutex sync.Mutex
+	var active, maxActive int
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mutex.Unlock()
+		<-release
+		mutex.Lock()
+		active--
+		mutex.Unlock()
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1,"error_code":null,"error":null}]}`))
+	}))
+	defer server.Close()
+
+	p := newBatchingProxyProducer(queueProducer.MessageProducerConfig{Addr: server.URL, Topic: "topic"},
+		proxyBatchConfig{MaxMessages: 1, Linger: time.Minute, MaxInFlight: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, p.SendMessage("", queueProducer.Message{Headers: map[string]string{"X-Request-Id": fmt.Sprintf("tid_%d", i)}, Body: "body"}))
+		}(i)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	mutex.Lock()
+	assert.Equal(t, 2, active, "Two batches should be posted at the same time, the third one waiting for one of them")
+	mutex.Unlock()
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 2, maxActive)
+}
+
+func TestBatchingProducerStopPostsPendingBatch(t *testing.T) {
+	var mutex sync.Mutex
+	var posted int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		posted++
+		mutex.Unlock()
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1,"error_code":null,"error":null}]}`))
+	}))
+	defer server.Close()
+
+	p := newBatchingProxyProducer(queueProducer.MessageProducerConfig{Addr: server.URL, Topic: "topic"},
+		proxyBatchConfig{MaxMessages: 100, Linger: time.Hour}).(*batchingProxyProducer)
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- p.SendMessage("", queueProducer.Message{Headers: map[string]string{"X-Request-Id": "tid_1"}, Body: "body"})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	p.stop()
+
+	assert.NoError(t, <-sent)
+	mutex.Lock()
+	assert.Equal(t, 1, posted)
+	mutex.Unlock()
+}
+
+func TestCheckBatchWorkers(t *testing.T) {
+	var tests = []struct {
+		maxMessages   int
+		workerCount   int
+		expectedError string
+	}{
+		{1, 1, ""},
+		{10, 4, ""},
+		{10, 1, "-producer_batch_max_messages=10 requires -worker_count greater than 1, a single worker would wait for -producer_batch_linger on every message"},
+	}
+
+	for _, test := range tests {
+		err := checkBatchWorkers(proxyBatchConfig{MaxMessages: test.maxMessages}, test.workerCount)
+		if test.expectedError == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, test.expectedError)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// cachedCheck keeps the last result of a check, so that health endpoints don't call the dependencies on every request.
+type cachedCheck struct {
+	checker   func() (string, error)
+	timeout   time.Duration
+	mutex     sync.Mutex
+	running   bool
+	output    string
+	err       error
+	checkedAt time.Time
+	clock     clock
+}
+
+func newCachedCheck(checker func() (string, error), timeout time.Duration, clock clock) *cachedCheck {
+	return &cachedCheck{
+		checker: checker,
+		timeout: timeout,
+		clock:   clock,
+	}
+}
+
+// refresh runs the check and stores its result. A check running over the timeout is reported as failed;
+// it is left to finish in the background and no other refresh is started until it does.
+func (c *cachedCheck) refresh() {
+	c.mutex.Lock()
+	if c.running {
+		c.mutex.Unlock()
+		return
+	}
+	c.running = true
+	c.mutex.Unlock()
+
+	type result struct {
+		output string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := c.checker()
+		c.mutex.Lock()
+		c.running = false
+		c.mutex.Unlock()
+		done <- result{output, err}
+	}()
+
+	var r result
+	select {
+	case r = <-done:
+	case <-time.After(c.timeout):
+		r = result{err: fmt.Errorf("Check timed out after %v.", c.timeout)}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.output, c.err, c.checkedAt = r.output, r.err, c.clock.now()
+}
+
+// check returns the last result, annotated with its age.
+func (c *cachedCheck) check() (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.checkedAt.IsZero() {
+		return "", errors.New("Check has not run yet.")
+	}
+
+	age := fmt.Sprintf("(checked %v ago)", c.clock.now().Sub(c.checkedAt).Truncate(time.Second))
+	if c.err != nil {
+		return c.output, fmt.Errorf("%s %s", c.err.Error(), age)
+	}
+	if c.output == "" {
+		return age, nil
+	}
+	return c.output + " " + age, nil
+}
+
+// refreshChecks refreshes all the checks straight away, then every interval, forever.
+func refreshChecks(interval time.Duration, checks ...*cachedCheck) {
+	for {
+		var wg sync.WaitGroup
+		for _, c := range checks {
+			wg.Add(1)
+			go func(c *cachedCheck) {
+				defer wg.Done()
+				c.refresh()
+			}(c)
+		}
+		wg.Wait()
+		time.Sleep(interval)
+	}
+}
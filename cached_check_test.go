@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedCheckNotRunYet(t *testing.T) {
+	c := newCachedCheck(func() (string, error) { return "", nil }, time.Second, newFakeClock())
+
+	_, err := c.check()
+	assert.EqualError(t, err, "Check has not run yet.")
+}
+
+func TestCachedCheckServesLastResultWithAge(t *testing.T) {
+	clock := newFakeClock()
+	calls := 0
+	c := newCachedCheck(func() (string, error) {
+		calls++
+		return "All good.", nil
+	}, time.Second, clock)
+
+	c.refresh()
+	clock.advance(12 * time.Second)
+
+	for i := 0; i < 3; i++ {
+		output, err := c.check()
+		assert.NoError(t, err)
+		assert.Equal(t, "All good. (checked 12s ago)", output)
+	}
+	assert.Equal(t, 1, calls, "The checker should only be called on refresh")
+}
+
+func TestCachedCheckServesLastError(t *testing.T) {
+	c := newCachedCheck(func() (string, error) {
+		return "Forwarding messages is broken.", errors.New("Status: 503.")
+	}, time.Second, newFakeClock())
+
+	c.refresh()
+	output, err := c.check()
+	assert.Equal(t, "Forwarding messages is broken.", output)
+	assert.EqualError(t, err, "Status: 503. (checked 0s ago)")
+}
+
+func TestCachedCheckTimesOut(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	c := newCachedCheck(func() (string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "", nil
+	}, 10*time.Millisecond, newFakeClock())
+
+	c.refresh()
+	_, err := c.check()
+	assert.EqualError(t, err, "Check timed out after 10ms. (checked 0s ago)")
+
+	c.refresh()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "No refresh should start while the previous check is still running")
+	close(release)
+}
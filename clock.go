@@ -0,0 +1,15 @@
+package main
+
+import "time"
+
+// clock tells the time. The monitors of the bridge are given one, so that tests can set the time they see.
+type clock interface {
+	now() time.Time
+}
+
+// systemClock is the clock of the system the bridge runs on.
+type systemClock struct{}
+
+func (systemClock) now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// fakeClock is a clock the tests set and move forward. It starts at 2015-07-06 12:00:00 UTC.
+type fakeClock struct {
+	mutex sync.Mutex
+	time  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{time: time.Date(2015, 7, 6, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.time
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.time = c.time.Add(d)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
+)
+
+// lagIdleTimeout is how long the consumer can go without consuming a message while the source topic has unread ones
+// before it is reported as stalled.
+const lagIdleTimeout = 5 * time.Minute
+
+// consumerLagMonitor measures how many messages the consumer instance of the bridge is behind the head of the partitions
+// of the source topic assigned to it: the difference between the end offsets of the partitions, read from kafka-proxy in
+// the background, and the offsets the bridge consumed up to, read from the records kafka-proxy returns to the consumer.
+// The partitions assigned to the other instances of the consumer group, e.g. the other replica of the bridge, are left out.
+// Until the bridge consumes from an assigned partition, the end offset of the partition when it was first seen assigned
+// is used instead, so that a consumer stuck since startup still shows the messages published after it started as lag.
+type consumerLagMonitor struct {
+	mutex             sync.Mutex
+	readEndOffsets    func() (map[int32]int64, error)
+	readAssignments   func() ([]int32, error)
+	endOffsets        map[int32]int64
+	readErr           error
+	assigned          map[int32]bool
+	assignedOffsets   map[int32]int64
+	positions         map[int32]int64
+	started           time.Time
+	lastConsumed      time.Time
+	warningThreshold  int64
+	criticalThreshold int64
+	clock             clock
+}
+
+func newConsumerLagMonitor(readEndOffsets func() (map[int32]int64, error), readAssignments func() ([]int32, error), warningThreshold int64, criticalThreshold int64, clock clock) *consumerLagMonitor {
+	return &consumerLagMonitor{
+		readEndOffsets:    readEndOffsets,
+		readAssignments:   readAssignments,
+		assignedOffsets:   make(map[int32]int64),
+		positions:         make(map[int32]int64),
+		started:           clock.now(),
+		warningThreshold:  warningThreshold,
+		criticalThreshold: criticalThreshold,
+		clock:             clock,
+	}
+}
+
+// observe records the offsets of the records returned to the consumer.
+func (m *consumerLagMonitor) observe(records []kafkaRecord) {
+	if len(records) == 0 {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, record := range records {
+		if next := record.Offset + 1; next > m.positions[record.Partition] {
+			m.positions[record.Partition] = next
+		}
+	}
+	m.lastConsumed = m.clock.now()
+}
+
+// refresh reads the end offsets of the source topic and the partitions assigned to the consumer instance. It runs in the
+// background with the other connectivity checks.
+func (m *consumerLagMonitor) refresh() (string, error) {
+	endOffsets, err := m.readEndOffsets()
+	var partitions []int32
+	if err == nil {
+		partitions, err = m.readAssignments()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.readErr = err
+	if err != nil {
+		return "", err
+	}
+	m.endOffsets = endOffsets
+	m.assigned = make(map[int32]bool, len(partitions))
+	for _, partition := range partitions {
+		m.assigned[partition] = true
+		if _, seen := m.assignedOffsets[partition]; !seen {
+			m.assignedOffsets[partition] = endOffsets[partition]
+		}
+	}
+	// a partition assigned again after a rebalance is measured from its end offset at that time
+	for partition := range m.assignedOffsets {
+		if !m.assigned[partition] {
+			delete(m.assignedOffsets, partition)
+		}
+	}
+	for partition := range m.positions {
+		if !m.assigned[partition] {
+			delete(m.positions, partition)
+		}
+	}
+	return "", nil
+}
+
+// currentLag returns the number of messages the consumer is behind, whether the consumer is stalled, i.e. it hasn't
+// consumed anything for lagIdleTimeout, and an error when the end offsets couldn't be read.
+func (m *consumerLagMonitor) currentLag() (int64, bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.readErr != nil {
+		return 0, false, fmt.Errorf("Couldn't read the end offsets of the partitions assigned to the consumer: %v", m.readErr.Error())
+	}
+	if m.endOffsets == nil {
+		return 0, false, errors.New("The end offsets of the source topic haven't been read yet.")
+	}
+
+	var lag int64
+	for partition := range m.assigned {
+		end := m.endOffsets[partition]
+		position, consumed := m.positions[partition]
+		if !consumed {
+			position = m.assignedOffsets[partition]
+		}
+		if end > position {
+			lag += end - position
+		}
+	}
+
+	lastActivity := m.lastConsumed
+	if lastActivity.IsZero() {
+		lastActivity = m.started
+	}
+	return lag, m.clock.now().Sub(lastActivity) > lagIdleTimeout, nil
+}
+
+// check fails when the lag is over the warning threshold, when the consumer is stalled while there are unread messages,
+// or when the end offsets of the source topic can't be read.
+func (m *consumerLagMonitor) check() (string, error) {
+	lag, stalled, err := m.currentLag()
+	if err != nil {
+		return "Consumer lag is unknown.", err
+	}
+	if stalled && lag > 0 {
+		return "", fmt.Errorf("Consumer hasn't consumed any message in the last %v while %d messages are waiting in the source topic.", lagIdleTimeout, lag)
+	}
+	return checkLagThreshold(lag, m.warningThreshold)
+}
+
+// criticalCheck fails when the lag is over the critical threshold. The end offsets being unknown doesn't fail it, the
+// consume healthcheck reports kafka-proxy being unreachable already.
+func (m *consumerLagMonitor) criticalCheck() (string, error) {
+	lag, _, err := m.currentLag()
+	if err != nil {
+		return "Consumer lag is unknown.", nil
+	}
+	return checkLagThreshold(lag, m.criticalThreshold)
+}
+
+func checkLagThreshold(lag int64, threshold int64) (string, error) {
+	if threshold > 0 && lag > threshold {
+		return "", fmt.Errorf("Consumer is %d messages behind the source topic, over the threshold of %d.", lag, threshold)
+	}
+	return fmt.Sprintf("Consumer is %d messages behind the source topic.", lag), nil
+}
+
+// newEndOffsetsReader returns a function reading the end offsets of the partitions of the source topic from the first
+// source kafka-proxy.
+func newEndOffsetsReader(config *queueConsumer.QueueConfig, client *http.Client) func() (map[int32]int64, error) {
+	return func() (map[int32]int64, error) {
+		if len(config.Addrs) == 0 {
+			return nil, errors.New("No source kafka-proxy address is configured")
+		}
+		addr := config.Addrs[0]
+
+		var partitions []struct {
+			Partition int32 `json:"partition"`
+		}
+		if err := getProxyJSON(client, fmt.Sprintf("%s/topics/%s/partitions", addr, config.Topic), config.AuthorizationKey, &partitions); err != nil {
+			return nil, err
+		}
+
+		endOffsets := make(map[int32]int64, len(partitions))
+		for _, p := range partitions {
+			var offsets struct {
+				EndOffset int64 `json:"end_offset"`
+			}
+			if err := getProxyJSON(client, fmt.Sprintf("%s/topics/%s/partitions/%d/offsets", addr, config.Topic, p.Partition), config.AuthorizationKey, &offsets); err != nil {
+				return nil, err
+			}
+			endOffsets[p.Partition] = offsets.EndOffset
+		}
+		return endOffsets, nil
+	}
+}
+
+// newAssignmentsReader returns a function reading the partitions assigned to the consumer instance the bridge last made
+// a request with, from the kafka-proxy it made the request to.
+func newAssignmentsReader(observer *consumerObserver, config *queueConsumer.QueueConfig, client *http.Client) func() ([]int32, error) {
+	return func() ([]int32, error) {
+		instanceURL := observer.instanceURL()
+		if instanceURL == "" {
+			return nil, errors.New("The consumer instance isn't known yet")
+		}
+
+		var assignments struct {
+			Partitions []struct {
+				Topic     string `json:"topic"`
+				Partition int32  `json:"partition"`
+			} `json:"partitions"`
+		}
+		if err := getProxyJSON(client, instanceURL+"/assignments", config.AuthorizationKey, &assignments); err != nil {
+			return nil, err
+		}
+		var partitions []int32
+		for _, p := range assignments.Partitions {
+			if p.Topic == config.Topic {
+				partitions = append(partitions, p.Partition)
+			}
+		}
+		return partitions, nil
+	}
+}
+
+func getProxyJSON(client *http.Client, url string, authorizationKey string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("Error creating kafka-proxy request: %v", err.Error())
+	}
+	req.Header.Add("Accept", "application/vnd.kafka.v2+json")
+	if authorizationKey != "" {
+		req.Header.Add("Authorization", authorizationKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error executing GET request to kafka-proxy %s: %v", url, err.Error())
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Request to kafka-proxy %s failed. Status: %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("Couldn't parse the response of kafka-proxy %s: %v", url, err.Error())
+	}
+	return nil
+}
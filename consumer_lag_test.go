@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubEndOffsets serves the end offsets of the source topic, and the partitions assigned to the consumer instance, every
+// partition unless assigned is set.
+type stubEndOffsets struct {
+	offsets  map[int32]int64
+	assigned []int32
+	err      error
+}
+
+func (s *stubEndOffsets) read() (map[int32]int64, error) {
+	return s.offsets, s.err
+}
+
+func (s *stubEndOffsets) assignments() ([]int32, error) {
+	if s.assigned != nil {
+		return s.assigned, nil
+	}
+	var partitions []int32
+	for partition := range s.offsets {
+		partitions = append(partitions, partition)
+	}
+	return partitions, nil
+}
+
+func TestConsumerLagChecks(t *testing.T) {
+	var tests = []struct {
+		name                  string
+		initialEndOffsets     map[int32]int64
+		endOffsets            map[int32]int64
+		idle                  time.Duration
+		records               []kafkaRecord
+		expectedOutput        string
+		expectedError         string
+		expectedCriticalError string
+	}{
+		{
+			name:              "up to date",
+			initialEndOffsets: map[int32]int64{0: 10, 1: 20},
+			endOffsets:        map[int32]int64{0: 12, 1: 21},
+			records:           []kafkaRecord{{Partition: 0, Offset: 10}, {Partition: 0, Offset: 11}},
+			expectedOutput:    "Consumer is 1 messages behind the source topic.",
+		},
+		{
+			name:              "over the warning threshold",
+			initialEndOffsets: map[int32]int64{0: 1000, 1: 1000},
+			endOffsets:        map[int32]int64{0: 1000, 1: 1000},
+			records:           []kafkaRecord{{Partition: 0, Offset: 799}, {Partition: 1, Offset: 999}},
+			expectedError:     "Consumer is 200 messages behind the source topic, over the threshold of 100.",
+		},
+		{
+			name:                  "over the critical threshold",
+			initialEndOffsets:     map[int32]int64{0: 1000, 1: 1000},
+			endOffsets:            map[int32]int64{0: 3000, 1: 1000},
+			records:               []kafkaRecord{{Partition: 0, Offset: 799}, {Partition: 1, Offset: 999}},
+			expectedError:         "Consumer is 2200 messages behind the source topic, over the threshold of 100.",
+			expectedCriticalError: "Consumer is 2200 messages behind the source topic, over the threshold of 1000.",
+		},
+		{
+			name:              "idle with nothing to read",
+			initialEndOffsets: map[int32]int64{0: 10},
+			endOffsets:        map[int32]int64{0: 10},
+			idle:              lagIdleTimeout + time.Second,
+			expectedOutput:    "Consumer is 0 messages behind the source topic.",
+		},
+		{
+			name:              "stalled",
+			initialEndOffsets: map[int32]int64{0: 10},
+			endOffsets:        map[int32]int64{0: 12},
+			idle:              lagIdleTimeout + time.Second,
+			expectedError:     "Consumer hasn't consumed any message in the last 5m0s while 2 messages are waiting in the source topic.",
+		},
+		{
+			name:              "consuming again after a stall",
+			initialEndOffsets: map[int32]int64{0: 10},
+			endOffsets:        map[int32]int64{0: 12},
+			idle:              lagIdleTimeout + time.Second,
+			records:           []kafkaRecord{{Partition: 0, Offset: 10}},
+			expectedOutput:    "Consumer is 1 messages behind the source topic.",
+		},
+	}
+
+	for _, test := range tests {
+		clock := newFakeClock()
+		endOffsets := &stubEndOffsets{offsets: test.initialEndOffsets}
+		m := newConsumerLagMonitor(endOffsets.read, endOffsets.assignments, 100, 1000, clock)
+		m.refresh()
+
+		clock.advance(test.idle)
+		endOffsets.offsets = test.endOffsets
+		m.refresh()
+		m.observe(test.records)
+
+		output, err := m.check()
+		if test.expectedError == "" {
+			assert.NoError(t, err, test.name)
+			assert.Equal(t, test.expectedOutput, output, test.name)
+		} else {
+			assert.EqualError(t, err, test.expectedError, test.name)
+		}
+		_, err = m.criticalCheck()
+		if test.expectedCriticalError == "" {
+			assert.NoError(t, err, test.name)
+		} else {
+			assert.EqualError(t, err, test.expectedCriticalError, test.name)
+		}
+	}
+}
+
+func TestConsumerLagUnknownEndOffsets(t *testing.T) {
+	endOffsets := &stubEndOffsets{err: errors.New("Status: 404")}
+	m := newConsumerLagMonitor(endOffsets.read, endOffsets.assignments, 100, 1000, newFakeClock())
+
+	_, err := m.check()
+	assert.EqualError(t, err, "The end offsets of the source topic haven't been read yet.")
+
+	m.refresh()
+	_, err = m.check()
+	assert.EqualError(t, err, "Couldn't read the end offsets of the partitions assigned to the consumer: Status: 404")
+	_, err = m.criticalCheck()
+	assert.NoError(t, err)
+}
+
+func TestConsumerLagOfInstancesSharingAGroup(t *testing.T) {
+	clock := newFakeClock()
+	first := &stubEndOffsets{offsets: map[int32]int64{0: 10, 1: 10}, assigned: []int32{0}}
+	second := &stubEndOffsets{offsets: first.offsets, assigned: []int32{1}}
+	firstMonitor := newConsumerLagMonitor(first.read, first.assignments, 100, 1000, clock)
+	secondMonitor := newConsumerLagMonitor(second.read, second.assignments, 100, 1000, clock)
+	firstMonitor.refresh()
+	secondMonitor.refresh()
+
+	first.offsets[0], first.offsets[1] = 5000, 5000
+	firstMonitor.refresh()
+	secondMonitor.refresh()
+	firstMonitor.observe([]kafkaRecord{{Partition: 0, Offset: 4999}})
+	secondMonitor.observe([]kafkaRecord{{Partition: 1, Offset: 4999}})
+
+	for _, m := range []*consumerLagMonitor{firstMonitor, secondMonitor} {
+		output, err := m.check()
+		assert.NoError(t, err)
+		assert.Equal(t, "Consumer is 0 messages behind the source topic.", output, "The partition of the other instance isn't lag")
+		_, err = m.criticalCheck()
+		assert.NoError(t, err)
+	}
+
+	// the second instance stops, and its partition is assigned to the first one
+	first.assigned = []int32{0, 1}
+	first.offsets[1] = 5100
+	firstMonitor.refresh()
+	first.offsets[1] = 5150
+	firstMonitor.refresh()
+	output, err := firstMonitor.check()
+	assert.NoError(t, err)
+	assert.Equal(t, "Consumer is 50 messages behind the source topic.", output, "A newly assigned partition is measured from its end offset when it was assigned")
+
+	first.assigned = []int32{1}
+	firstMonitor.refresh()
+	output, _ = firstMonitor.check()
+	assert.Equal(t, "Consumer is 50 messages behind the source topic.", output, "A revoked partition isn't lag anymore")
+	assert.NotContains(t, firstMonitor.positions, int32(0))
+}
+
+func TestAssignmentsReader(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "authorizationkey", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/__kafka-rest-proxy/consumers/kafka-bridge/instances/rest-consumer-1/topics/NativeCmsPublicationEvents":
+			w.Write([]byte(`[]`))
+		case "/__kafka-rest-proxy/consumers/kafka-bridge/instances/rest-consumer-1/assignments":
+			w.Write([]byte(`{"partitions":[{"topic":"NativeCmsPublicationEvents","partition":1},{"topic":"Other","partition":0}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer proxy.Close()
+
+	config := &queueConsumer.QueueConfig{Addrs: []string{proxy.URL + "/__kafka-rest-proxy"}, Topic: "NativeCmsPublicationEvents", AuthorizationKey: "authorizationkey"}
+	observer := newConsumerObserver(http.DefaultTransport, systemClock{})
+	read := newAssignmentsReader(observer, config, http.DefaultClient)
+	_, err := read()
+	assert.EqualError(t, err, "The consumer instance isn't known yet")
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/__kafka-rest-proxy/consumers/kafka-bridge/instances/rest-consumer-1/topics/NativeCmsPublicationEvents", nil)
+	req.Header.Add("Authorization", "authorizationkey")
+	resp, err := (&http.Client{Transport: observer}).Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	partitions, err := read()
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{1}, partitions)
+}
+
+func TestEndOffsetsReader(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "authorizationkey", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/topics/NativeCmsPublicationEvents/partitions":
+			w.Write([]byte(`[{"partition":0,"leader":1},{"partition":1,"leader":2}]`))
+		case "/topics/NativeCmsPublicationEvents/partitions/0/offsets":
+			w.Write([]byte(`{"beginning_offset":3,"end_offset":42}`))
+		case "/topics/NativeCmsPublicationEvents/partitions/1/offsets":
+			w.Write([]byte(`{"beginning_offset":0,"end_offset":7}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer proxy.Close()
+
+	read := newEndOffsetsReader(&queueConsumer.QueueConfig{Addrs: []string{proxy.URL}, Topic: "NativeCmsPublicationEvents", AuthorizationKey: "authorizationkey"}, http.DefaultClient)
+	endOffsets, err := read()
+	assert.NoError(t, err)
+	assert.Equal(t, map[int32]int64{0: 42, 1: 7}, endOffsets)
+
+	read = newEndOffsetsReader(&queueConsumer.QueueConfig{Addrs: []string{proxy.URL}, Topic: "Unknown", AuthorizationKey: "authorizationkey"}, http.DefaultClient)
+	_, err = read()
+	assert.EqualError(t, err, "Request to kafka-proxy "+proxy.URL+"/topics/Unknown/partitions failed. Status: 404")
+}
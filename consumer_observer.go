@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
+)
+
+// consumerPollTimeout is how long the observed state of the consumer is trusted without a new request to kafka-proxy.
+const consumerPollTimeout = time.Minute
+
+// consumerObserver sits between the running consumer and kafka-proxy, recording the outcome of every request the consumer makes.
+type consumerObserver struct {
+	transport    http.RoundTripper
+	mutex        sync.Mutex
+	lastRequest  time.Time
+	lastSuccess  time.Time
+	lastErr      error
+	lastInstance string
+	instanceBase string
+	keys         *recordKeys
+	lag          *consumerLagMonitor
+	clock        clock
+}
+
+func newConsumerObserver(transport http.RoundTripper, clock clock) *consumerObserver {
+	return &consumerObserver{
+		transport: transport,
+		keys:      newRecordKeys(clock),
+		clock:     clock,
+	}
+}
+
+func (o *consumerObserver) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := o.transport.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusOK && isConsumeRequest(req) {
+		records := readRecords(resp)
+		o.keys.add(records)
+		if o.lag != nil {
+			o.lag.observe(records)
+		}
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.lastRequest = o.clock.now()
+	if instance := consumerInstance(req.URL.Path); instance != "" {
+		o.lastInstance = instance
+		o.instanceBase = consumerInstanceURL(req.URL)
+	}
+	switch {
+	case err != nil:
+		o.lastErr = err
+	case resp.StatusCode >= http.StatusBadRequest:
+		o.lastErr = fmt.Errorf("Request to kafka-proxy %s %s failed. Status: %d", req.Method, req.URL.Path, resp.StatusCode)
+	default:
+		o.lastErr = nil
+		o.lastSuccess = o.lastRequest
+	}
+	return resp, err
+}
+
+// messageKey returns the kafka key of the record a just consumed message came in, or an empty string if it had none.
+func (o *consumerObserver) messageKey(msg queueConsumer.Message) string {
+	return o.keys.take(msg.Headers["Message-Id"])
+}
+
+// instanceURL returns the URL of the consumer instance the consumer last made a request with, e.g.
+// http://kafka-proxy/consumers/{group}/instances/{instance}, or an empty string before its first request.
+func (o *consumerObserver) instanceURL() string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.instanceBase
+}
+
+// lastRequestTime returns when the consumer last made a request to kafka-proxy, successful or not.
+func (o *consumerObserver) lastRequestTime() time.Time {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.lastRequest
+}
+
+// consumerInstance extracts the consumer instance id from kafka-proxy paths like /consumers/{group}/instances/{instance}/...
+func consumerInstance(path string) string {
+	parts := strings.Split(path, "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] == "instances" {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+// consumerInstanceURL returns the URL up to the consumer instance id of a kafka-proxy consumer request.
+func consumerInstanceURL(u *url.URL) string {
+	parts := strings.Split(u.Path, "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] == "instances" {
+			return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: strings.Join(parts[:i+2], "/")}).String()
+		}
+	}
+	return ""
+}
+
+// check reports the outcome of the consumer's last request to kafka-proxy. When the consumer hasn't made any request recently,
+// for example before it has started, the probe is used instead.
+func (o *consumerObserver) check(probe func() (string, error)) (string, error) {
+	o.mutex.Lock()
+	lastRequest, lastSuccess, lastErr, instance := o.lastRequest, o.lastSuccess, o.lastErr, o.lastInstance
+	now := o.clock.now()
+	o.mutex.Unlock()
+
+	if lastRequest.IsZero() || now.Sub(lastRequest) > consumerPollTimeout {
+		return probe()
+	}
+
+	if lastErr != nil {
+		if lastSuccess.IsZero() {
+			return "Consuming messages is broken.", lastErr
+		}
+		return fmt.Sprintf("Consuming messages is broken. Last successful request at %s.", formatTime(lastSuccess)), lastErr
+	}
+	if instance == "" {
+		return fmt.Sprintf("Last request to kafka-proxy at %s succeeded.", formatTime(lastRequest)), nil
+	}
+	return fmt.Sprintf("Last request to kafka-proxy at %s by consumer instance %s succeeded.", formatTime(lastRequest), instance), nil
+}
+
+// newConsumerProbe returns a lightweight check of whether the source kafka-proxy can be reached, without creating a consumer instance.
+func newConsumerProbe(config *queueConsumer.QueueConfig, client *http.Client) func() (string, error) {
+	return func() (string, error) {
+		if len(config.Addrs) == 0 {
+			return "Consuming messages is broken.", errors.New("No source kafka-proxy address is configured")
+		}
+		for _, addr := range config.Addrs {
+			if err := probeProxy(addr, config.AuthorizationKey, client); err != nil {
+				return "Consuming messages is broken.", err
+			}
+		}
+		return "Source kafka-proxy is reachable.", nil
+	}
+}
+
+func probeProxy(addr string, authorizationKey string, client *http.Client) error {
+	req, err := http.NewRequest("GET", addr+"/topics", nil)
+	if err != nil {
+		return fmt.Errorf("Error creating kafka-proxy probe request: %v", err.Error())
+	}
+	if authorizationKey != "" {
+		req.Header.Add("Authorization", authorizationKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error executing GET request to kafka-proxy %s: %v", addr, err.Error())
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Request to kafka-proxy %s/topics failed. Status: %d", addr, resp.StatusCode)
+	}
+	return nil
+}
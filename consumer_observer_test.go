@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockTransport struct {
+	status int
+	body   string
+	err    error
+}
+
+func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	return &http.Response{StatusCode: t.status, Body: ioutil.NopCloser(strings.NewReader(t.body)), Request: req}, nil
+}
+
+func failingProbe() (string, error) {
+	return "Consuming messages is broken.", errors.New("probe failed")
+}
+
+func TestConsumerObserverUsesProbeBeforeFirstPoll(t *testing.T) {
+	clock := newFakeClock()
+	o := newConsumerObserver(&mockTransport{status: http.StatusOK}, clock)
+
+	_, err := o.check(failingProbe)
+	assert.EqualError(t, err, "probe failed")
+}
+
+func TestConsumerObserverReportsLastPoll(t *testing.T) {
+	clock := newFakeClock()
+	transport := &mockTransport{status: http.StatusOK}
+	o := newConsumerObserver(transport, clock)
+	client := &http.Client{Transport: o}
+
+	_, err := client.Get("http://kafka-proxy/consumers/kafka-bridge/instances/rest-consumer-1/topics/NativeCmsPublicationEvents")
+	assert.NoError(t, err)
+
+	output, err := o.check(failingProbe)
+	assert.NoError(t, err)
+	assert.Equal(t, "Last request to kafka-proxy at 2015-07-06T12:00:00Z by consumer instance rest-consumer-1 succeeded.", output)
+
+	clock.advance(10 * time.Second)
+	transport.status = http.StatusNotFound
+	client.Get("http://kafka-proxy/consumers/kafka-bridge/instances/rest-consumer-1/topics/NativeCmsPublicationEvents")
+
+	output, err = o.check(failingProbe)
+	assert.EqualError(t, err, "Request to kafka-proxy GET /consumers/kafka-bridge/instances/rest-consumer-1/topics/NativeCmsPublicationEvents failed. Status: 404")
+	assert.Equal(t, "Consuming messages is broken. Last successful request at 2015-07-06T12:00:00Z.", output)
+
+	transport.err = errors.New("connection refused")
+	client.Get("http://kafka-proxy/consumers/kafka-bridge/instances/rest-consumer-1/topics/NativeCmsPublicationEvents")
+	_, err = o.check(failingProbe)
+	assert.Contains(t, err.Error(), "connection refused")
+}
+
+func TestConsumerObserverFallsBackToProbeWhenQuiet(t *testing.T) {
+	clock := newFakeClock()
+	o := newConsumerObserver(&mockTransport{status: http.StatusOK}, clock)
+	client := &http.Client{Transport: o}
+
+	client.Get("http://kafka-proxy/topics")
+	clock.advance(consumerPollTimeout + time.Second)
+
+	_, err := o.check(failingProbe)
+	assert.EqualError(t, err, "probe failed")
+}
+
+func TestConsumerObserverRecordsMessageKeys(t *testing.T) {
+	clock := newFakeClock()
+	transport := &mockTransport{
+		status: http.StatusOK,
+		body: `[{"key":"OWQxY2RiZDY=","value":"RlRNU0cvMS4wCk1lc3NhZ2UtSWQ6IGZjNDI5YjQ2LTI1MDAtNGZlNy04OGJiLWZkNTA3ZmJhZjAwYwoKe30=","partition":0,"offset":12},` +
+			`{"key":null,"value":"RlRNU0cvMS4wCk1lc3NhZ2UtSWQ6IDM0ZTUzNmFkLTZkODQtNGJjOC1iYjhkLTVkZWNjNjUyMjM0ZgoKe30=","partition":1,"offset":7}]`,
+	}
+	o := newConsumerObserver(transport, clock)
+	o.lag = newConsumerLagMonitor((&stubEndOffsets{}).read, (&stubEndOffsets{}).assignments, 0, 0, clock)
+	client := &http.Client{Transport: o}
+
+	resp, err := client.Get("http://kafka-proxy/consumers/kafka-bridge/instances/rest-consumer-1/topics/NativeCmsPublicationEvents")
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, transport.body, string(body), "The consumer should still be able to read the records")
+	assert.Equal(t, map[int32]int64{0: 13, 1: 8}, o.lag.positions)
+
+	withKey := queueConsumer.Message{Headers: map[string]string{"Message-Id": "fc429b46-2500-4fe7-88bb-fd507fbaf00c"}}
+	withoutKey := queueConsumer.Message{Headers: map[string]string{"Message-Id": "34e536ad-6d84-4bc8-bb8d-5decc652234f"}}
+	assert.Equal(t, "9d1cdbd6", o.messageKey(withKey))
+	assert.Equal(t, "", o.messageKey(withKey), "Keys are forgotten once taken")
+	assert.Equal(t, "", o.messageKey(withoutKey))
+
+	client.Get("http://kafka-proxy/consumers/kafka-bridge/instances/rest-consumer-1/topics/NativeCmsPublicationEvents")
+	clock.advance(consumerPollTimeout + time.Second)
+	transport.body = "[]"
+	client.Get("http://kafka-proxy/consumers/kafka-bridge/instances/rest-consumer-1/topics/NativeCmsPublicationEvents")
+	assert.Equal(t, "", o.messageKey(withKey), "Keys of messages which never reached the handler expire")
+}
+
+func TestFTMessageID(t *testing.T) {
+	assert.Equal(t, "fc429b46-2500-4fe7-88bb-fd507fbaf00c", ftMessageID("FTMSG/1.0\nMessage-Id: fc429b46-2500-4fe7-88bb-fd507fbaf00c\nMessage-Type: cms-content-published\n\n{}"))
+	assert.Equal(t, "", ftMessageID("FTMSG/1.0\nMessage-Type: cms-content-published\n\n{\"Message-Id: fc429b46\"}"))
+	assert.Equal(t, "", ftMessageID("not an FT message"))
+}
+
+func TestConsumerProbe(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/topics", r.URL.Path)
+		assert.Equal(t, "authorizationkey", r.Header.Get("Authorization"))
+		w.Write([]byte(`["NativeCmsPublicationEvents"]`))
+	}))
+	defer healthy.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	probe := newConsumerProbe(&queueConsumer.QueueConfig{Addrs: []string{healthy.URL}, AuthorizationKey: "authorizationkey"}, http.DefaultClient)
+	_, err := probe()
+	assert.NoError(t, err)
+
+	probe = newConsumerProbe(&queueConsumer.QueueConfig{Addrs: []string{healthy.URL, broken.URL}, AuthorizationKey: "authorizationkey"}, http.DefaultClient)
+	_, err = probe()
+	assert.EqualError(t, err, "Request to kafka-proxy "+broken.URL+"/topics failed. Status: 503")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kafkaRecord is a record of a kafka-proxy consume response. gonsumer only hands the FT message in its value over to the
+// bridge, so the bridge reads what else it needs from the responses themselves.
+type kafkaRecord struct {
+	Key       *string `json:"key"`
+	Value     string  `json:"value"`
+	Partition int32   `json:"partition"`
+	Offset    int64   `json:"offset"`
+}
+
+// recordKeys remembers the kafka keys of the records just consumed by the Message-Id of their FT message, until the
+// message reaches the consumer handler.
+type recordKeys struct {
+	mutex sync.Mutex
+	keys  map[string]recordKey
+	clock clock
+}
+
+type recordKey struct {
+	key      string
+	consumed time.Time
+}
+
+func newRecordKeys(clock clock) *recordKeys {
+	return &recordKeys{keys: make(map[string]recordKey), clock: clock}
+}
+
+// add remembers the keys of the records. Keys of messages gonsumer never handed over, e.g. because they couldn't be
+// parsed, are forgotten after consumerPollTimeout.
+func (k *recordKeys) add(records []kafkaRecord) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	now := k.clock.now()
+	for messageID, key := range k.keys {
+		if now.Sub(key.consumed) > consumerPollTimeout {
+			delete(k.keys, messageID)
+		}
+	}
+	for _, record := range records {
+		if record.Key == nil {
+			continue
+		}
+		if messageID := ftMessageID(decodeRecordField(record.Value)); messageID != "" {
+			k.keys[messageID] = recordKey{key: decodeRecordField(*record.Key), consumed: now}
+		}
+	}
+}
+
+// take returns the kafka key of the message with the Message-Id and forgets it, or an empty string if it had none.
+func (k *recordKeys) take(messageID string) string {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	key := k.keys[messageID]
+	delete(k.keys, messageID)
+	return key.key
+}
+
+// isConsumeRequest tells whether the request reads records, i.e. GET /consumers/{group}/instances/{instance}/topics/{topic}.
+func isConsumeRequest(req *http.Request) bool {
+	return req.Method == "GET" && consumerInstance(req.URL.Path) != "" && strings.Contains(req.URL.Path, "/topics/")
+}
+
+// readRecords parses the records of a consume response, leaving the body for gonsumer to read.
+func readRecords(resp *http.Response) []kafkaRecord {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	var records []kafkaRecord
+	if err := json.Unmarshal(body, &records); err != nil {
+		return nil
+	}
+	return records
+}
+
+// decodeRecordField decodes the base64 keys and values of the binary embedded format, and returns other ones as they are.
+func decodeRecordField(field string) string {
+	decoded, err := base64.StdEncoding.DecodeString(field)
+	if err != nil {
+		return field
+	}
+	return string(decoded)
+}
+
+// ftMessageID reads the Message-Id header of an FT message, e.g. "FTMSG/1.0\nMessage-Id: ...\n\n{...}".
+func ftMessageID(message string) string {
+	scanner := bufio.NewScanner(strings.NewReader(message))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			return ""
+		}
+		if strings.HasPrefix(line, "Message-Id:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "Message-Id:"))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Authentication methods of the control endpoints.
+const (
+	tokenAuth      = "token"
+	basicAuth      = "basic"
+	clientCertAuth = "cert"
+)
+
+// authenticator decides whether a request to the control endpoints is allowed.
+type authenticator interface {
+	authenticate(r *http.Request) error
+	// challenge is the WWW-Authenticate header sent back with a rejected request.
+	challenge() string
+}
+
+type controlAuthConfig struct {
+	Method           string
+	TokenFile        string
+	BasicAuthFile    string
+	AllowedCertNames []string
+}
+
+func newAuthenticator(config controlAuthConfig) (authenticator, error) {
+	switch config.Method {
+	case tokenAuth:
+		return newBearerTokenAuthenticator(config.TokenFile)
+	case basicAuth:
+		return newBasicAuthenticator(config.BasicAuthFile)
+	case clientCertAuth:
+		return clientCertAuthenticator{allowedNames: config.AllowedCertNames}, nil
+	default:
+		return nil, fmt.Errorf("Unknown authentication method '%s', it should be %s, %s or %s", config.Method, tokenAuth, basicAuth, clientCertAuth)
+	}
+}
+
+// requireAuth only lets through the requests the authenticator allows.
+func requireAuth(auth authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := auth.authenticate(r); err != nil {
+			if challenge := auth.challenge(); challenge != "" {
+				w.Header().Set("WWW-Authenticate", challenge)
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bearerTokenAuthenticator requires the "Authorization: Bearer <token>" header, with the token read from a file on startup.
+type bearerTokenAuthenticator struct {
+	token []byte
+}
+
+func newBearerTokenAuthenticator(tokenFile string) (authenticator, error) {
+	content, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read the token file: %v", err.Error())
+	}
+	token := bytes.TrimSpace(content)
+	if len(token) == 0 {
+		return nil, fmt.Errorf("The token file %s is empty", tokenFile)
+	}
+	return bearerTokenAuthenticator{token: token}, nil
+}
+
+func (a bearerTokenAuthenticator) authenticate(r *http.Request) error {
+	authorization := r.Header.Get("Authorization")
+	provided := strings.TrimPrefix(authorization, "Bearer ")
+	if provided == authorization || subtle.ConstantTimeCompare([]byte(provided), a.token) != 1 {
+		return errors.New("Missing or invalid bearer token")
+	}
+	return nil
+}
+
+func (a bearerTokenAuthenticator) challenge() string {
+	return "Bearer"
+}
+
+// basicAuthenticator requires HTTP basic auth against the user:password lines of a file read on startup.
+type basicAuthenticator struct {
+	passwords map[string]string
+}
+
+func newBasicAuthenticator(credentialsFile string) (authenticator, error) {
+	content, err := ioutil.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read the basic auth file: %v", err.Error())
+	}
+
+	passwords := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("The basic auth file %s should only have user:password lines", credentialsFile)
+		}
+		passwords[parts[0]] = parts[1]
+	}
+	if len(passwords) == 0 {
+		return nil, fmt.Errorf("The basic auth file %s has no credentials", credentialsFile)
+	}
+	return basicAuthenticator{passwords: passwords}, nil
+}
+
+func (a basicAuthenticator) authenticate(r *http.Request) error {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return errors.New("Missing basic auth credentials")
+	}
+	expected, found := a.passwords[user]
+	if !found || subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 {
+		return errors.New("Invalid basic auth credentials")
+	}
+	return nil
+}
+
+func (a basicAuthenticator) challenge() string {
+	return `Basic realm="kafka-bridge"`
+}
+
+// clientCertAuthenticator requires a client certificate verified against the client CA of the control server.
+// When allowedNames is set, the common name of the certificate must also be one of them.
+type clientCertAuthenticator struct {
+	allowedNames []string
+}
+
+func (a clientCertAuthenticator) authenticate(r *http.Request) error {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return errors.New("Missing verified client certificate")
+	}
+	if len(a.allowedNames) == 0 {
+		return nil
+	}
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	for _, allowed := range a.allowedNames {
+		if name == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("Client certificate %s is not allowed", name)
+}
+
+func (a clientCertAuthenticator) challenge() string {
+	return ""
+}
+
+// newControlTLSConfig returns the TLS config of the control server, or nil when it serves plain HTTP.
+// With a client CA, client certificates signed by it are required.
+func newControlTLSConfig(certFile string, keyFile string, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, errors.New("A client CA requires a TLS certificate and key")
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't load the TLS certificate: %v", err.Error())
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	caCerts, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read the client CA file: %v", err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCerts) {
+		return nil, fmt.Errorf("The client CA file %s has no PEM certificates", clientCAFile)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return config, nil
+}
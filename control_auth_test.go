@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTempFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "control-auth")
+	assert.NoError(t, err)
+	file := filepath.Join(dir, "credentials")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func TestBearerTokenAuthenticator(t *testing.T) {
+	tokenFile := writeTempFile(t, "s3cr3t\n")
+	defer os.RemoveAll(filepath.Dir(tokenFile))
+
+	auth, err := newAuthenticator(controlAuthConfig{Method: tokenAuth, TokenFile: tokenFile})
+	assert.NoError(t, err)
+
+	var tests = []struct {
+		authorization string
+		expectedCode  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"s3cr3t", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer s3cr3t", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "http://example.com/debug/gc", nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		w := httptest.NewRecorder()
+		requireAuth(auth, okHandler()).ServeHTTP(w, req)
+		assert.Equal(t, test.expectedCode, w.Code, test.authorization)
+		if test.expectedCode == http.StatusUnauthorized {
+			assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestBearerTokenAuthenticatorRejectsEmptyToken(t *testing.T) {
+	tokenFile := writeTempFile(t, " \n")
+	defer os.RemoveAll(filepath.Dir(tokenFile))
+
+	_, err := newAuthenticator(controlAuthConfig{Method: tokenAuth, TokenFile: tokenFile})
+	assert.Error(t, err)
+
+	_, err = newAuthenticator(controlAuthConfig{Method: tokenAuth, TokenFile: "/does/not/exist"})
+	assert.Error(t, err)
+}
+
+func TestBasicAuthenticator(t *testing.T) {
+	credentialsFile := writeTempFile(t, "# on-call\nops:p4ss:word\n\nsre:other\n")
+	defer os.RemoveAll(filepath.Dir(credentialsFile))
+
+	auth, err := newAuthenticator(controlAuthConfig{Method: basicAuth, BasicAuthFile: credentialsFile})
+	assert.NoError(t, err)
+
+	var tests = []struct {
+		user         string
+		password     string
+		expectedCode int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"ops", "wrong", http.StatusUnauthorized},
+		{"unknown", "p4ss:word", http.StatusUnauthorized},
+		{"ops", "p4ss:word", http.StatusOK},
+		{"sre", "other", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "http://example.com/debug/gc", nil)
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.password)
+		}
+		w := httptest.NewRecorder()
+		requireAuth(auth, okHandler()).ServeHTTP(w, req)
+		assert.Equal(t, test.expectedCode, w.Code, test.user)
+	}
+}
+
+func TestBasicAuthenticatorRejectsInvalidFile(t *testing.T) {
+	for _, content := range []string{"", "# nobody\n", "ops\n", "ops:\n"} {
+		credentialsFile := writeTempFile(t, content)
+		_, err := newAuthenticator(controlAuthConfig{Method: basicAuth, BasicAuthFile: credentialsFile})
+		assert.Error(t, err, content)
+		os.RemoveAll(filepath.Dir(credentialsFile))
+	}
+}
+
+func TestClientCertAuthenticator(t *testing.T) {
+	verified := func(commonName string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	var tests = []struct {
+		allowedNames []string
+		tls          *tls.ConnectionState
+		expectedCode int
+	}{
+		{nil, nil, http.StatusUnauthorized},
+		{nil, &tls.ConnectionState{}, http.StatusUnauthorized},
+		{nil, verified("anyone"), http.StatusOK},
+		{[]string{"ops", "sre"}, verified("sre"), http.StatusOK},
+		{[]string{"ops", "sre"}, verified("anyone"), http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		auth, err := newAuthenticator(controlAuthConfig{Method: clientCertAuth, AllowedCertNames: test.allowedNames})
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest("GET", "http://example.com/debug/gc", nil)
+		req.TLS = test.tls
+		w := httptest.NewRecorder()
+		requireAuth(auth, okHandler()).ServeHTTP(w, req)
+		assert.Equal(t, test.expectedCode, w.Code)
+	}
+}
+
+func TestUnknownAuthenticationMethod(t *testing.T) {
+	_, err := newAuthenticator(controlAuthConfig{Method: "none"})
+	assert.EqualError(t, err, "Unknown authentication method 'none', it should be token, basic or cert")
+}
+
+func TestControlTLSConfig(t *testing.T) {
+	config, err := newControlTLSConfig("", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, config, "Without a certificate the control endpoints are served over plain HTTP")
+
+	_, err = newControlTLSConfig("", "", "/etc/ssl/client-ca.pem")
+	assert.Error(t, err)
+
+	_, err = newControlTLSConfig("/does/not/exist.pem", "/does/not/exist.key", "")
+	assert.Error(t, err)
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	runtimePprof "runtime/pprof"
+)
+
+// gcRecentPauses is the number of most recent GC pauses reported by the GC stats endpoint.
+const gcRecentPauses = 10
+
+// registerDiagnostics adds the pprof, goroutine dump and GC stats endpoints to the router, all of them requiring authentication.
+func registerDiagnostics(router *http.ServeMux, auth authenticator) {
+	router.Handle("/debug/pprof/", requireAuth(auth, http.HandlerFunc(pprof.Index)))
+	router.Handle("/debug/pprof/cmdline", requireAuth(auth, http.HandlerFunc(pprof.Cmdline)))
+	router.Handle("/debug/pprof/profile", requireAuth(auth, http.HandlerFunc(pprof.Profile)))
+	router.Handle("/debug/pprof/symbol", requireAuth(auth, http.HandlerFunc(pprof.Symbol)))
+	router.Handle("/debug/pprof/trace", requireAuth(auth, http.HandlerFunc(pprof.Trace)))
+	router.Handle("/debug/goroutines", requireAuth(auth, http.HandlerFunc(goroutineDump)))
+	router.Handle("/debug/gc", requireAuth(auth, http.HandlerFunc(gcStats)))
+}
+
+// goroutineDump writes the stack traces of all goroutines, in the same format as an unrecovered panic.
+func goroutineDump(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	runtimePprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+type gcStatsResponse struct {
+	Goroutines    int      `json:"goroutines"`
+	HeapAlloc     uint64   `json:"heapAlloc"`
+	HeapInuse     uint64   `json:"heapInuse"`
+	HeapObjects   uint64   `json:"heapObjects"`
+	Sys           uint64   `json:"sys"`
+	NextGC        uint64   `json:"nextGC"`
+	NumGC         int64    `json:"numGC"`
+	LastGC        string   `json:"lastGC,omitempty"`
+	PauseTotal    string   `json:"pauseTotal"`
+	RecentPauses  []string `json:"recentPauses"`
+	GCCPUFraction float64  `json:"gcCPUFraction"`
+}
+
+// gcStats returns the memory and garbage collection statistics of the runtime as JSON.
+func gcStats(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	gc := debug.GCStats{}
+	debug.ReadGCStats(&gc)
+
+	stats := gcStatsResponse{
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     mem.HeapAlloc,
+		HeapInuse:     mem.HeapInuse,
+		HeapObjects:   mem.HeapObjects,
+		Sys:           mem.Sys,
+		NextGC:        mem.NextGC,
+		NumGC:         gc.NumGC,
+		PauseTotal:    gc.PauseTotal.String(),
+		GCCPUFraction: mem.GCCPUFraction,
+	}
+	if !gc.LastGC.IsZero() {
+		stats.LastGC = formatTime(gc.LastGC)
+	}
+	for i, pause := range gc.Pause {
+		if i == gcRecentPauses {
+			break
+		}
+		stats.RecentPauses = append(stats.RecentPauses, pause.String())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnosticsRequireAuthentication(t *testing.T) {
+	router := http.NewServeMux()
+	registerDiagnostics(router, bearerTokenAuthenticator{token: []byte("s3cr3t")})
+
+	var tests = []struct {
+		authorization string
+		expectedCode  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"s3cr3t", http.StatusUnauthorized},
+		{"Bearer s3cr3t", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "http://example.com/debug/pprof/", nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, test.expectedCode, w.Code, test.authorization)
+	}
+}
+
+func TestGoroutineDump(t *testing.T) {
+	w := httptest.NewRecorder()
+	goroutineDump(w, httptest.NewRequest("GET", "http://example.com/debug/goroutines", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "TestGoroutineDump"), "The dump should contain the stack of the calling goroutine")
+}
+
+func TestGCStats(t *testing.T) {
+	w := httptest.NewRecorder()
+	gcStats(w, httptest.NewRequest("GET", "http://example.com/debug/gc", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	stats := gcStatsResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.True(t, stats.Goroutines > 0)
+	assert.True(t, stats.HeapAlloc > 0)
+}
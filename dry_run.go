@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Financial-Times/go-logger"
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+)
+
+// dryRunMessagesMetric counts the messages which would have been forwarded if the bridge wasn't running with -dry_run.
+const dryRunMessagesMetric = "messages_dry_run"
+
+// dryRunConsumerGroup returns the consumer group a dry run consumes with. It must be its own, so that the dry run neither
+// takes messages from the bridge running with -consumer_group_id nor commits offsets for it.
+func dryRunConsumerGroup(consumerGroup string, dryRunGroup string) (string, error) {
+	if dryRunGroup == "" {
+		return "", errors.New("-dry_run requires -dry_run_consumer_group_id")
+	}
+	if dryRunGroup == consumerGroup {
+		return "", fmt.Errorf("-dry_run_consumer_group_id should differ from -consumer_group_id, both are '%s'", consumerGroup)
+	}
+	return dryRunGroup, nil
+}
+
+// requestPreviewer is implemented by producers which can describe what they would send for a message without sending it.
+type requestPreviewer interface {
+	preview(message queueProducer.Message) string
+}
+
+// previewMessage describes what the producer would send for the message. Producers which don't map the message
+// to a request of their own are described by the headers of the message.
+func previewMessage(p queueProducer.MessageProducer, message queueProducer.Message) string {
+	if previewer, ok := p.(requestPreviewer); ok {
+		return previewer.preview(message)
+	}
+	return fmt.Sprintf("message with headers %s and a body of %d bytes", formatHeaders(message.Headers), len(message.Body))
+}
+
+// formatHeaders lists the headers sorted by name. The Authorization header is redacted.
+func formatHeaders(headers map[string]string) string {
+	var fields []string
+	for key, value := range headers {
+		if strings.EqualFold(key, "Authorization") {
+			value = "redacted"
+		}
+		fields = append(fields, key+": "+value)
+	}
+	sort.Strings(fields)
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// observeDryRun logs and counts the message the bridge would have forwarded.
+func (bridge BridgeApp) observeDryRun(tid string, message queueProducer.Message) {
+	logger.NewMonitoringEntry("Forwarding", tid, "").Info("Dry run, the message hasn't been forwarded. Forwarding it would have sent: " + previewMessage(bridge.producerInstance, message))
+	bridge.metrics.counter(dryRunMessagesMetric).Inc()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	errorRateBuckets     = 30
+	errorRateMinMessages = 10
+	errorRateLastErrors  = 5
+)
+
+// errorRateMonitor counts forwarding outcomes over a sliding window, split into buckets, and keeps the most recent errors.
+type errorRateMonitor struct {
+	mutex      sync.Mutex
+	window     time.Duration
+	bucketSize time.Duration
+	threshold  float64
+	buckets    [errorRateBuckets]outcomeBucket
+	lastErrors []string
+	clock      clock
+}
+
+type outcomeBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+func newErrorRateMonitor(window time.Duration, threshold float64, clock clock) *errorRateMonitor {
+	bucketSize := window / errorRateBuckets
+	if bucketSize <= 0 {
+		bucketSize = time.Nanosecond
+	}
+	return &errorRateMonitor{
+		window:     window,
+		bucketSize: bucketSize,
+		threshold:  threshold,
+		clock:      clock,
+	}
+}
+
+func (m *errorRateMonitor) success() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.currentBucket().successes++
+}
+
+func (m *errorRateMonitor) failure(tid string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.currentBucket().failures++
+
+	m.lastErrors = append(m.lastErrors, fmt.Sprintf("%s %s: %s", formatTime(m.clock.now()), tid, err.Error()))
+	if len(m.lastErrors) > errorRateLastErrors {
+		m.lastErrors = m.lastErrors[len(m.lastErrors)-errorRateLastErrors:]
+	}
+}
+
+func (m *errorRateMonitor) currentBucket() *outcomeBucket {
+	start := m.clock.now().Truncate(m.bucketSize)
+	bucket := &m.buckets[(start.UnixNano()/int64(m.bucketSize))%errorRateBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = outcomeBucket{start: start}
+	}
+	return bucket
+}
+
+// lastError returns the most recent forwarding error, or an empty string if there was none.
+func (m *errorRateMonitor) lastError() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.lastErrors) == 0 {
+		return ""
+	}
+	return m.lastErrors[len(m.lastErrors)-1]
+}
+
+// outcomes returns the number of successful and failed forwards within the window.
+func (m *errorRateMonitor) outcomes() (int, int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	oldest := m.clock.now().Add(-m.window)
+	var successes, failures int
+	for _, bucket := range m.buckets {
+		if bucket.start.After(oldest) {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+	return successes, failures
+}
+
+// check fails when the share of failed forwards within the window is over the threshold.
+// Windows with fewer than errorRateMinMessages forwards are never considered failing.
+func (m *errorRateMonitor) check() (string, error) {
+	successes, failures := m.outcomes()
+	total := successes + failures
+	if total == 0 {
+		return fmt.Sprintf("No messages forwarded in the last %v.", m.window), nil
+	}
+
+	rate := float64(failures) / float64(total)
+	summary := fmt.Sprintf("%d of %d forwards failed (%.1f%%) in the last %v.", failures, total, rate*100, m.window)
+	if total < errorRateMinMessages || rate <= m.threshold {
+		return summary, nil
+	}
+
+	m.mutex.Lock()
+	lastErrors := strings.Join(m.lastErrors, "; ")
+	m.mutex.Unlock()
+	return "", fmt.Errorf("%s This is over the threshold of %.1f%%. Last errors: %s", summary, m.threshold*100, lastErrors)
+}
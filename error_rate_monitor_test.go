@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorRateMonitor(t *testing.T) {
+	var tests = []struct {
+		name           string
+		successes      int
+		failures       int
+		expectedOutput string
+		expectedError  string
+	}{
+		{
+			name:           "no messages",
+			expectedOutput: "No messages forwarded in the last 5m0s.",
+		},
+		{
+			name:           "under the threshold",
+			successes:      99,
+			failures:       1,
+			expectedOutput: "1 of 100 forwards failed (1.0%) in the last 5m0s.",
+		},
+		{
+			name:           "too few messages",
+			failures:       1,
+			expectedOutput: "1 of 1 forwards failed (100.0%) in the last 5m0s.",
+		},
+		{
+			name:      "over the threshold",
+			successes: 14,
+			failures:  6,
+			expectedError: "6 of 20 forwards failed (30.0%) in the last 5m0s. This is over the threshold of 5.0%. " +
+				"Last errors: 2015-07-06T12:00:00Z tid_2: Status: 503; 2015-07-06T12:00:00Z tid_3: Status: 503; 2015-07-06T12:00:00Z tid_4: Status: 503; " +
+				"2015-07-06T12:00:00Z tid_5: Status: 503; 2015-07-06T12:00:00Z tid_6: Status: 503",
+		},
+	}
+
+	for _, test := range tests {
+		m := newErrorRateMonitor(5*time.Minute, 0.05, newFakeClock())
+		for i := 0; i < test.successes; i++ {
+			m.success()
+		}
+		for i := 1; i <= test.failures; i++ {
+			m.failure(fmt.Sprintf("tid_%d", i), errors.New("Status: 503"))
+		}
+
+		output, err := m.check()
+		if test.expectedError == "" {
+			assert.NoError(t, err, test.name)
+			assert.Equal(t, test.expectedOutput, output, test.name)
+		} else {
+			assert.EqualError(t, err, test.expectedError, test.name)
+		}
+	}
+}
+
+func TestErrorRateSlidingWindow(t *testing.T) {
+	clock := newFakeClock()
+	m := newErrorRateMonitor(5*time.Minute, 0.05, clock)
+
+	for i := 0; i < 20; i++ {
+		m.failure("tid_failed", errors.New("Status: 503"))
+	}
+	clock.advance(3 * time.Minute)
+	for i := 0; i < 20; i++ {
+		m.success()
+	}
+
+	successes, failures := m.outcomes()
+	assert.Equal(t, 20, successes)
+	assert.Equal(t, 20, failures)
+
+	clock.advance(3 * time.Minute)
+	successes, failures = m.outcomes()
+	assert.Equal(t, 20, successes)
+	assert.Equal(t, 0, failures, "Failures older than the window should be forgotten")
+
+	_, err := m.check()
+	assert.NoError(t, err)
+}
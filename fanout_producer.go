@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Financial-Times/go-logger"
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+)
+
+const fanout = "fanout"
+
+// Fan-out policies, deciding when forwarding a message to several destinations succeeded.
+const (
+	fanoutAll                = "all"
+	fanoutBestEffort         = "best-effort"
+	fanoutPrimaryPlusMirrors = "primary-plus-mirrors"
+)
+
+// fanoutConfig is the JSON of -producer_destinations.
+type fanoutConfig struct {
+	Policy       string              `json:"policy"`
+	Destinations []destinationConfig `json:"destinations"`
+}
+
+// destinationConfig describes one destination. The topic and the authorization default to -topic and -producer_vulcan_auth.
+type destinationConfig struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Address       string `json:"address"`
+	Topic         string `json:"topic"`
+	Authorization string `json:"authorization"`
+}
+
+type bridgeDestination struct {
+	name     string
+	config   destinationConfig
+	producer queueProducer.MessageProducer
+}
+
+// fanoutProducer forwards every message to all its destinations in parallel. With the primary-plus-mirrors policy
+// the first destination is the primary one.
+type fanoutProducer struct {
+	policy       string
+	destinations []bridgeDestination
+}
+
+func init() {
+	registerProducer(producerFactory{
+		Name:        fanout,
+		Description: "Forwards every message to each of the destinations of -producer_destinations, with a policy of all, best-effort or primary-plus-mirrors.",
+		Settings: []producerSetting{
+			{Flag: "producer_destinations", Required: true},
+			{Flag: "topic"},
+			{Flag: "producer_vulcan_auth"},
+		},
+		Flags: func(flags *flag.FlagSet) interface{} {
+			return flags.String("producer_destinations", "", `JSON of the destinations of the fanout producer type, e.g. {"policy":"primary-plus-mirrors","destinations":[{"name":"eu","type":"proxy","address":"http://kafka-proxy-eu:8080"},{"name":"us","type":"proxy","address":"http://kafka-proxy-us:8080"}]}.`)
+		},
+		New: newFanoutProducer,
+	})
+}
+
+func newFanoutProducer(settings producerSettings) (queueProducer.MessageProducer, error) {
+	destinations := stringOption(settings, fanout)
+	if destinations == "" {
+		return nil, errors.New("Producer type fanout requires -producer_destinations")
+	}
+	config := fanoutConfig{}
+	if err := json.Unmarshal([]byte(destinations), &config); err != nil {
+		return nil, fmt.Errorf("Couldn't parse -producer_destinations: %v", err.Error())
+	}
+	if config.Policy == "" {
+		config.Policy = fanoutAll
+	}
+	if config.Policy != fanoutAll && config.Policy != fanoutBestEffort && config.Policy != fanoutPrimaryPlusMirrors {
+		return nil, fmt.Errorf("Unknown fan-out policy '%s', it should be %s, %s or %s", config.Policy, fanoutAll, fanoutBestEffort, fanoutPrimaryPlusMirrors)
+	}
+	if len(config.Destinations) == 0 {
+		return nil, errors.New("-producer_destinations has no destinations")
+	}
+
+	p := &fanoutProducer{policy: config.Policy}
+	for i, destination := range config.Destinations {
+		if destination.Name == "" {
+			destination.Name = fmt.Sprintf("destination-%d", i+1)
+		}
+		d, err := newDestination(destination, settings)
+		if err != nil {
+			return nil, err
+		}
+		p.destinations = append(p.destinations, d)
+	}
+	return p, nil
+}
+
+// newDestination builds the producer of a destination of a fanout or router producer, which can't have destinations of their own.
+func newDestination(destination destinationConfig, settings producerSettings) (bridgeDestination, error) {
+	if destination.Type == fanout || destination.Type == router {
+		return bridgeDestination{}, fmt.Errorf("Destination %s can't be a %s itself", destination.Name, destination.Type)
+	}
+	if destination.Topic == "" {
+		destination.Topic = settings.Config.Topic
+	}
+	if destination.Authorization == "" {
+		destination.Authorization = settings.Config.Authorization
+	}
+	producer, err := newProducer(destination.Type, producerSettings{
+		Config: queueProducer.MessageProducerConfig{
+			Addr:          destination.Address,
+			Topic:         destination.Topic,
+			Authorization: destination.Authorization,
+		},
+		Options: settings.Options,
+	})
+	if err != nil {
+		return bridgeDestination{}, fmt.Errorf("Invalid destination %s: %v", destination.Name, err.Error())
+	}
+	return bridgeDestination{name: destination.Name, config: destination, producer: producer}, nil
+}
+
+// describe lists the destinations in the status of the bridge.
+func (p *fanoutProducer) describe(status *destinationStatus) {
+	status.Policy = p.policy
+	for _, destination := range p.destinations {
+		status.Destinations = append(status.Destinations, destination.status())
+	}
+}
+
+func (d bridgeDestination) status() destinationStatus {
+	summary := destinationStatus{
+		Name:         d.name,
+		Address:      redactURL(d.config.Address),
+		ProducerType: d.config.Type,
+	}
+	if d.config.Type == proxy {
+		summary.Topic = d.config.Topic
+	}
+	return summary
+}
+
+func (p *fanoutProducer) SendMessage(uuid string, message queueProducer.Message) error {
+	errs := make([]error, len(p.destinations))
+	var wg sync.WaitGroup
+	for i, destination := range p.destinations {
+		wg.Add(1)
+		go func(i int, destination bridgeDestination) {
+			defer wg.Done()
+			headers := make(map[string]string, len(message.Headers))
+			for key, value := range message.Headers {
+				headers[key] = value
+			}
+			errs[i] = destination.producer.SendMessage(uuid, queueProducer.Message{Headers: headers, Body: message.Body})
+		}(i, destination)
+	}
+	wg.Wait()
+
+	failed, failures := p.failures(errs)
+	if failed == 0 {
+		return nil
+	}
+	switch p.policy {
+	case fanoutBestEffort:
+		if failed < len(p.destinations) {
+			logger.NewEntry(message.Headers["X-Request-Id"]).WithUUID(uuid).Info("Forwarding to some destinations failed: " + failures)
+			return nil
+		}
+	case fanoutPrimaryPlusMirrors:
+		if errs[0] == nil {
+			logger.NewEntry(message.Headers["X-Request-Id"]).WithUUID(uuid).Info("Forwarding to mirrors failed: " + failures)
+			return nil
+		}
+	}
+	return errors.New("Forwarding failed for " + failures)
+}
+
+func (p *fanoutProducer) stop() {
+	for _, destination := range p.destinations {
+		stopProducer(destination.producer)
+	}
+}
+
+// preview describes what each destination would be sent.
+func (p *fanoutProducer) preview(message queueProducer.Message) string {
+	var previews []string
+	for _, destination := range p.destinations {
+		previews = append(previews, fmt.Sprintf("%s to %s", previewMessage(destination.producer, message), destination.name))
+	}
+	return strings.Join(previews, "; ")
+}
+
+// ConnectivityCheck fails when the destinations the policy depends on can't be reached.
+func (p *fanoutProducer) ConnectivityCheck() (string, error) {
+	errs := make([]error, len(p.destinations))
+	var wg sync.WaitGroup
+	for i, destination := range p.destinations {
+		wg.Add(1)
+		go func(i int, destination bridgeDestination) {
+			defer wg.Done()
+			_, errs[i] = destination.producer.ConnectivityCheck()
+		}(i, destination)
+	}
+	wg.Wait()
+
+	failed, failures := p.failures(errs)
+	if failed == 0 {
+		return fmt.Sprintf("All %d destinations are reachable.", len(p.destinations)), nil
+	}
+	switch {
+	case p.policy == fanoutBestEffort && failed < len(p.destinations),
+		p.policy == fanoutPrimaryPlusMirrors && errs[0] == nil:
+		return "Forwarding to some destinations is broken: " + failures, nil
+	}
+	return "Forwarding messages is broken.", errors.New(failures)
+}
+
+// failures counts the failed destinations and describes their errors.
+func (p *fanoutProducer) failures(errs []error) (int, string) {
+	var descriptions []string
+	for i, err := range errs {
+		if err != nil {
+			descriptions = append(descriptions, fmt.Sprintf("%s: %s", p.destinations[i].name, err.Error()))
+		}
+	}
+	return len(descriptions), strings.Join(descriptions, "; ")
+}
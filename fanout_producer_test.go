@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubDestination struct {
+	mutex    sync.Mutex
+	err      error
+	messages []queueProducer.Message
+}
+
+func (d *stubDestination) SendMessage(uuid string, message queueProducer.Message) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.messages = append(d.messages, message)
+	return d.err
+}
+
+func (d *stubDestination) ConnectivityCheck() (string, error) {
+	if d.err != nil {
+		return "Forwarding messages is broken.", d.err
+	}
+	return "", nil
+}
+
+func newTestFanout(policy string, errs ...error) (*fanoutProducer, []*stubDestination) {
+	p := &fanoutProducer{policy: policy}
+	var stubs []*stubDestination
+	for i, err := range errs {
+		stub := &stubDestination{err: err}
+		stubs = append(stubs, stub)
+		p.destinations = append(p.destinations, bridgeDestination{name: []string{"primary", "mirror-1", "mirror-2"}[i], producer: stub})
+	}
+	return p, stubs
+}
+
+func TestFanoutPolicies(t *testing.T) {
+	unreachable := errors.New("Status: 503")
+	var tests = []struct {
+		policy        string
+		errs          []error
+		expectedError string
+	}{
+		{fanoutAll, []error{nil, nil, nil}, ""},
+		{fanoutAll, []error{nil, unreachable, nil}, "Forwarding failed for mirror-1: Status: 503"},
+		{fanoutBestEffort, []error{unreachable, nil, unreachable}, ""},
+		{fanoutBestEffort, []error{unreachable, unreachable, unreachable}, "Forwarding failed for primary: Status: 503; mirror-1: Status: 503; mirror-2: Status: 503"},
+		{fanoutPrimaryPlusMirrors, []error{nil, unreachable, unreachable}, ""},
+		{fanoutPrimaryPlusMirrors, []error{unreachable, nil, nil}, "Forwarding failed for primary: Status: 503"},
+	}
+
+	for _, test := range tests {
+		p, stubs := newTestFanout(test.policy, test.errs...)
+		err := p.SendMessage("", queueProducer.Message{Headers: map[string]string{"X-Request-Id": "tid_t9happe59y"}, Body: "{}"})
+		if test.expectedError == "" {
+			assert.NoError(t, err, test.policy)
+		} else {
+			assert.EqualError(t, err, test.expectedError, test.policy)
+		}
+		for _, stub := range stubs {
+			assert.Len(t, stub.messages, 1, "Every destination should get the message")
+		}
+
+		_, checkErr := p.ConnectivityCheck()
+		assert.Equal(t, test.expectedError == "", checkErr == nil, test.policy)
+	}
+}
+
+func TestFanoutDestinationsGetTheirOwnHeaders(t *testing.T) {
+	p, stubs := newTestFanout(fanoutAll, nil, nil)
+	message := queueProducer.Message{Headers: map[string]string{"X-Request-Id": "tid_t9happe59y"}, Body: "{}"}
+	assert.NoError(t, p.SendMessage("", message))
+
+	stubs[0].messages[0].Headers["X-Request-Id"] = "changed"
+	assert.Equal(t, "tid_t9happe59y", stubs[1].messages[0].Headers["X-Request-Id"])
+	assert.Equal(t, "tid_t9happe59y", message.Headers["X-Request-Id"])
+}
+
+func TestNewFanoutProducer(t *testing.T) {
+	p, err := newProducer(fanout, producerSettings{
+		Config: queueProducer.MessageProducerConfig{Topic: "NativeCmsPublicationEvents", Authorization: "vulcanauth"},
+		Options: parseProducerFlags(t, `-producer_destinations={"policy":"primary-plus-mirrors","destinations":[
+			{"name":"eu","type":"proxy","address":"http://kafka-proxy-eu:8080"},
+			{"type":"plainHTTP","address":"http://cms-notifier:8080","authorization":"other"}]}`),
+	})
+	assert.NoError(t, err)
+
+	fanOut := p.(*fanoutProducer)
+	assert.Equal(t, fanoutPrimaryPlusMirrors, fanOut.policy)
+	assert.Len(t, fanOut.destinations, 2)
+	assert.Equal(t, destinationConfig{Name: "eu", Type: proxy, Address: "http://kafka-proxy-eu:8080", Topic: "NativeCmsPublicationEvents", Authorization: "vulcanauth"}, fanOut.destinations[0].config)
+	assert.Equal(t, "destination-2", fanOut.destinations[1].name)
+	assert.Equal(t, "other", fanOut.destinations[1].config.Authorization)
+	assert.IsType(t, &plainHTTPMessageProducer{}, fanOut.destinations[1].producer)
+}
+
+func TestNewFanoutProducerInvalidConfig(t *testing.T) {
+	var tests = []struct {
+		destinations  string
+		expectedError string
+	}{
+		{"", "Producer type fanout requires -producer_destinations"},
+		{"{", "Couldn't parse -producer_destinations: unexpected end of JSON input"},
+		{`{"policy":"any","destinations":[{"type":"proxy","address":"http://kafka-proxy:8080"}]}`, "Unknown fan-out policy 'any', it should be all, best-effort or primary-plus-mirrors"},
+		{`{"destinations":[]}`, "-producer_destinations has no destinations"},
+		{`{"destinations":[{"name":"loop","type":"fanout"}]}`, "Destination loop can't be a fanout itself"},
+		{`{"destinations":[{"name":"eu","type":"kafka"}]}`, "Invalid destination eu: Unknown producer type 'kafka', it should be one of: fanout, plainHTTP, proxy, router"},
+		{`{"destinations":[{"name":"eu","type":"plainHTTP"}]}`, "Invalid destination eu: Producer type plainHTTP requires -producer_address"},
+	}
+
+	for _, test := range tests {
+		_, err := newProducer(fanout, producerSettings{Options: parseProducerFlags(t, "-producer_destinations="+test.destinations)})
+		assert.EqualError(t, err, test.expectedError, test.destinations)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// forwardingMonitor tracks when the bridge last consumed and last handled a message. A message is handled when it is
+// forwarded successfully, or deliberately not forwarded: dropped by a stage or a router, or logged by a dry run.
+type forwardingMonitor struct {
+	mutex        sync.Mutex
+	started      time.Time
+	lastConsumed time.Time
+	lastHandled  time.Time
+	quietPeriod  time.Duration
+	clock        clock
+}
+
+func newForwardingMonitor(quietPeriod time.Duration, clock clock) *forwardingMonitor {
+	return &forwardingMonitor{
+		started:     clock.now(),
+		quietPeriod: quietPeriod,
+		clock:       clock,
+	}
+}
+
+func (m *forwardingMonitor) consumed() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lastConsumed = m.clock.now()
+}
+
+func (m *forwardingMonitor) handled() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lastHandled = m.clock.now()
+}
+
+// check fails when messages are being consumed but none has been handled for longer than the quiet period.
+func (m *forwardingMonitor) check() (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.lastConsumed.IsZero() {
+		return "No messages have been consumed yet.", nil
+	}
+
+	since := m.lastHandled
+	if since.IsZero() {
+		since = m.started
+	}
+
+	if m.lastConsumed.After(since) && m.clock.now().Sub(since) > m.quietPeriod {
+		if m.lastHandled.IsZero() {
+			return "", fmt.Errorf("Messages are being consumed, last one at %s, but none has been forwarded or deliberately dropped since the bridge started at %s.", formatTime(m.lastConsumed), formatTime(m.started))
+		}
+		return "", fmt.Errorf("Messages are being consumed, last one at %s, but none has been forwarded or deliberately dropped since %s.", formatTime(m.lastConsumed), formatTime(m.lastHandled))
+	}
+
+	if m.lastHandled.IsZero() {
+		return fmt.Sprintf("Last message consumed at %s, no message handled yet.", formatTime(m.lastConsumed)), nil
+	}
+	return fmt.Sprintf("Last message consumed at %s, last message handled at %s.", formatTime(m.lastConsumed), formatTime(m.lastHandled)), nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
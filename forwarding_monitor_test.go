@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// forwardingEvent is a message consumed or handled, after the previous event or the start of the monitor.
+type forwardingEvent struct {
+	after   time.Duration
+	handled bool
+}
+
+func TestForwardingMonitor(t *testing.T) {
+	var tests = []struct {
+		name           string
+		events         []forwardingEvent
+		checkAfter     time.Duration
+		expectedOutput string
+		expectedError  string
+	}{
+		{
+			name:           "nothing consumed",
+			checkAfter:     time.Hour,
+			expectedOutput: "No messages have been consumed yet.",
+		},
+		{
+			name:           "quiet topic",
+			events:         []forwardingEvent{{0, false}, {time.Second, true}},
+			checkAfter:     time.Hour,
+			expectedOutput: "Last message consumed at 2015-07-06T12:00:00Z, last message handled at 2015-07-06T12:00:01Z.",
+		},
+		{
+			name:           "nothing handled within the quiet period",
+			events:         []forwardingEvent{{time.Minute, false}},
+			expectedOutput: "Last message consumed at 2015-07-06T12:01:00Z, no message handled yet.",
+		},
+		{
+			name:          "nothing handled since start",
+			events:        []forwardingEvent{{time.Minute, false}, {10 * time.Minute, false}},
+			expectedError: "Messages are being consumed, last one at 2015-07-06T12:11:00Z, but none has been forwarded or deliberately dropped since the bridge started at 2015-07-06T12:00:00Z.",
+		},
+		{
+			name:          "handling stopped",
+			events:        []forwardingEvent{{0, false}, {0, true}, {20 * time.Minute, false}},
+			expectedError: "Messages are being consumed, last one at 2015-07-06T12:20:00Z, but none has been forwarded or deliberately dropped since 2015-07-06T12:00:00Z.",
+		},
+	}
+
+	for _, test := range tests {
+		clock := newFakeClock()
+		m := newForwardingMonitor(10*time.Minute, clock)
+		for _, event := range test.events {
+			clock.advance(event.after)
+			if event.handled {
+				m.handled()
+			} else {
+				m.consumed()
+			}
+		}
+		clock.advance(test.checkAfter)
+
+		output, err := m.check()
+		if test.expectedError == "" {
+			assert.NoError(t, err, test.name)
+			assert.Equal(t, test.expectedOutput, output, test.name)
+		} else {
+			assert.EqualError(t, err, test.expectedError, test.name)
+		}
+	}
+}
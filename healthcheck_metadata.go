@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
+)
+
+// Keys identifying the healthchecks in the healthcheck metadata configuration.
+const (
+	consumeCheckKey            = "consume"
+	forwardCheckKey            = "forward"
+	replicationLatencyCheckKey = "replication-latency"
+	consumerLagCheckKey        = "consumer-lag"
+	lastForwardCheckKey        = "last-forward"
+	errorRateCheckKey          = "error-rate"
+)
+
+// checkMetadata describes a healthcheck. Empty fields keep the value they already have.
+type checkMetadata struct {
+	Name             string `json:"name"`
+	Severity         uint8  `json:"severity"`
+	BusinessImpact   string `json:"businessImpact"`
+	PanicGuide       string `json:"panicGuide"`
+	TechnicalSummary string `json:"technicalSummary"`
+}
+
+// healthCheckMetadata overrides the built-in description of the healthchecks of a bridge.
+// The top level fields apply to every check, the ones under "checks" only to the check with that key. The name and the
+// technical summary describe a single check, so they can only be set under "checks".
+type healthCheckMetadata struct {
+	checkMetadata
+	Checks map[string]checkMetadata `json:"checks"`
+}
+
+func parseHealthCheckMetadata(config string) (healthCheckMetadata, error) {
+	metadata := healthCheckMetadata{}
+	if config == "" {
+		return metadata, nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(config))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&metadata); err != nil {
+		return metadata, err
+	}
+	if metadata.Name != "" || metadata.TechnicalSummary != "" {
+		return metadata, errors.New("name and technicalSummary can only be set for a single healthcheck, under checks")
+	}
+
+	valid := map[string]bool{
+		consumeCheckKey:            true,
+		forwardCheckKey:            true,
+		replicationLatencyCheckKey: true,
+		consumerLagCheckKey:        true,
+		lastForwardCheckKey:        true,
+		errorRateCheckKey:          true,
+	}
+	if err := metadata.checkMetadata.validate(); err != nil {
+		return metadata, err
+	}
+	for key, check := range metadata.Checks {
+		if !valid[key] {
+			return metadata, fmt.Errorf("Unknown healthcheck '%s'", key)
+		}
+		if err := check.validate(); err != nil {
+			return metadata, fmt.Errorf("Invalid metadata of healthcheck '%s': %v", key, err)
+		}
+	}
+	return metadata, nil
+}
+
+// validate rejects a severity FT healthchecks don't have. 0 means the severity isn't overridden.
+func (m checkMetadata) validate() error {
+	if m.Severity > 3 {
+		return fmt.Errorf("severity must be 1, 2 or 3, got %d", m.Severity)
+	}
+	return nil
+}
+
+func (m healthCheckMetadata) apply(key string, check fthealth.Check) fthealth.Check {
+	check = m.checkMetadata.apply(check)
+	if override, found := m.Checks[key]; found {
+		check = override.apply(check)
+	}
+	return check
+}
+
+func (m checkMetadata) apply(check fthealth.Check) fthealth.Check {
+	if m.Name != "" {
+		check.Name = m.Name
+	}
+	if m.Severity != 0 {
+		check.Severity = m.Severity
+	}
+	if m.BusinessImpact != "" {
+		check.BusinessImpact = m.BusinessImpact
+	}
+	if m.PanicGuide != "" {
+		check.PanicGuide = m.PanicGuide
+	}
+	if m.TechnicalSummary != "" {
+		check.TechnicalSummary = m.TechnicalSummary
+	}
+	return check
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEmptyHealthCheckMetadata(t *testing.T) {
+	metadata, err := parseHealthCheckMetadata("")
+	assert.NoError(t, err)
+
+	check := fthealth.Check{Name: "Consume messages from kafka-proxy", Severity: 1}
+	assert.Equal(t, check, metadata.apply(consumeCheckKey, check))
+}
+
+func TestParseInvalidHealthCheckMetadata(t *testing.T) {
+	var tests = []struct {
+		config        string
+		expectedError string
+	}{
+		{`{"severity":`, "unexpected EOF"},
+		{`{"checks":{"produce":{"severity":3}}}`, "Unknown healthcheck 'produce'"},
+		{`{"name":"Staging kafka bridge"}`, "name and technicalSummary can only be set for a single healthcheck, under checks"},
+		{`{"technicalSummary":"Check the staging kafka-proxy."}`, "name and technicalSummary can only be set for a single healthcheck, under checks"},
+		{`{"severity":4}`, "severity must be 1, 2 or 3, got 4"},
+		{`{"checks":{"consume":{"severity":9}}}`, "Invalid metadata of healthcheck 'consume': severity must be 1, 2 or 3, got 9"},
+		{`{"sevrity":3}`, `json: unknown field "sevrity"`},
+		{`{"checks":{"consume":{"panic_guide":"https://dewey.ft.com/kafka-bridge-staging.html"}}}`, `json: unknown field "panic_guide"`},
+	}
+
+	for _, test := range tests {
+		_, err := parseHealthCheckMetadata(test.config)
+		assert.EqualError(t, err, test.expectedError, test.config)
+	}
+}
+
+func TestApplyHealthCheckMetadata(t *testing.T) {
+	metadata, err := parseHealthCheckMetadata(`{
+		"severity": 3,
+		"panicGuide": "https://dewey.ft.com/kafka-bridge-staging.html",
+		"checks": {
+			"consume": {"name": "Consume messages from staging kafka-proxy", "severity": 2, "businessImpact": "Staging publishing won't be replicated."}
+		}
+	}`)
+	assert.NoError(t, err)
+
+	check := fthealth.Check{
+		Name:             "Consume messages from kafka-proxy",
+		Severity:         1,
+		BusinessImpact:   "Publishing in the containerised stack won't work.",
+		PanicGuide:       "https://dewey.ft.com/kafka-bridge.html",
+		TechnicalSummary: "Consuming messages is broken.",
+	}
+
+	consume := metadata.apply(consumeCheckKey, check)
+	assert.Equal(t, "Consume messages from staging kafka-proxy", consume.Name)
+	assert.Equal(t, uint8(2), consume.Severity)
+	assert.Equal(t, "Staging publishing won't be replicated.", consume.BusinessImpact)
+	assert.Equal(t, "https://dewey.ft.com/kafka-bridge-staging.html", consume.PanicGuide)
+	assert.Equal(t, "Consuming messages is broken.", consume.TechnicalSummary)
+
+	forward := metadata.apply(forwardCheckKey, check)
+	assert.Equal(t, "Consume messages from kafka-proxy", forward.Name)
+	assert.Equal(t, uint8(3), forward.Severity)
+	assert.Equal(t, "https://dewey.ft.com/kafka-bridge-staging.html", forward.PanicGuide)
+}
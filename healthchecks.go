@@ -1,27 +1,47 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
 	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/message-queue-go-producer/producer"
-	"github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/Financial-Times/service-status-go/buildinfo"
 	"github.com/Financial-Times/service-status-go/gtg"
 )
 
 type HealthCheck struct {
-	consumer     consumer.MessageConsumer
-	producer     producer.MessageProducer
-	producerType string
+	consumer           *cachedCheck
+	producer           *cachedCheck
+	producerType       string
+	replicationLatency *histogram
+	consumerLag        *consumerLagMonitor
+	forwarding         *forwardingMonitor
+	errorRate          *errorRateMonitor
+	metadata           healthCheckMetadata
 }
 
-func NewHealthCheck(consumerConf *consumer.QueueConfig, p producer.MessageProducer, producerType string, client *http.Client) *HealthCheck {
-	c := consumer.NewConsumer(*consumerConf, func(m consumer.Message) {}, client)
+// NewHealthCheck returns the bridge healthchecks. The consumer and the producer are checked in the background
+// every checkInterval, so serving the healthchecks never waits for the dependencies.
+func NewHealthCheck(consumerCheck func() (string, error), p producer.MessageProducer, producerType string, metrics *metricsRegistry, consumerLag *consumerLagMonitor, forwarding *forwardingMonitor, errorRate *errorRateMonitor, checkInterval time.Duration, checkTimeout time.Duration, metadata healthCheckMetadata) *HealthCheck {
+	consumerStatus := newCachedCheck(consumerCheck, checkTimeout, systemClock{})
+	producerStatus := newCachedCheck(p.ConnectivityCheck, checkTimeout, systemClock{})
+	checks := []*cachedCheck{consumerStatus, producerStatus}
+	if consumerLag != nil {
+		checks = append(checks, newCachedCheck(consumerLag.refresh, checkTimeout, systemClock{}))
+	}
+	go refreshChecks(checkInterval, checks...)
+
 	return &HealthCheck{
-		consumer:     c,
-		producer:     p,
-		producerType: producerType,
+		consumer:           consumerStatus,
+		producer:           producerStatus,
+		producerType:       producerType,
+		replicationLatency: metrics.histogram(replicationLatencyMetric),
+		consumerLag:        consumerLag,
+		forwarding:         forwarding,
+		errorRate:          errorRate,
+		metadata:           metadata,
 	}
 }
 
@@ -29,20 +49,37 @@ func NewHealthCheck(consumerConf *consumer.QueueConfig, p producer.MessageProduc
 func (hc HealthCheck) Health(serviceName string) func(w http.ResponseWriter, r *http.Request) {
 	description := "Services: source-kafka-proxy, cms-notifier"
 	checks := []fthealth.Check{
-		hc.consumeHealthcheck(), hc.httpForwarderHealthcheck(),
+		hc.consumeHealthcheck(), hc.httpForwarderHealthcheck(), hc.replicationLatencyHealthcheck(),
 	}
 
 	if hc.producerType == proxy {
 		description = "Services: source-kafka-proxy, destination-kafka-proxy"
-		checks = []fthealth.Check{hc.consumeHealthcheck(), hc.proxyForwarderHealthcheck()}
+		checks = []fthealth.Check{hc.consumeHealthcheck(), hc.proxyForwarderHealthcheck(), hc.replicationLatencyHealthcheck()}
+
+	}
+
+	if hc.producerType == fanout || hc.producerType == router {
+		description = "Services: source-kafka-proxy, " + hc.producerType + " destinations"
+		checks = []fthealth.Check{hc.consumeHealthcheck(), hc.multiDestinationForwarderHealthcheck(), hc.replicationLatencyHealthcheck()}
+	}
+
+	if hc.consumerLag != nil {
+		checks = append(checks, hc.consumerLagHealthcheck())
+	}
+
+	if hc.forwarding != nil {
+		checks = append(checks, hc.lastForwardHealthcheck())
+	}
 
+	if hc.errorRate != nil {
+		checks = append(checks, hc.errorRateHealthcheck())
 	}
 
 	healthCheck := fthealth.TimedHealthCheck{
 		HealthCheck: fthealth.HealthCheck{
 			SystemCode:  serviceName,
 			Name:        "Dependent services healthcheck",
-			Description: description,
+			Description: description + ". " + describeBuild(buildinfo.GetBuildInfo()),
 			Checks:      checks,
 		},
 		Timeout: 10 * time.Second,
@@ -52,51 +89,125 @@ func (hc HealthCheck) Health(serviceName string) func(w http.ResponseWriter, r *
 }
 
 func (hc HealthCheck) consumeHealthcheck() fthealth.Check {
-	return fthealth.Check{
+	return hc.metadata.apply(consumeCheckKey, fthealth.Check{
 		BusinessImpact:   "Consuming messages through kafka-proxy won't work. Publishing in the containerised stack won't work.",
 		Name:             "Consume messages from kafka-proxy",
 		PanicGuide:       "https://dewey.ft.com/kafka-bridge.html",
 		Severity:         1,
-		TechnicalSummary: "Consuming messages is broken. Check if source proxy is reachable.",
-		Checker:          hc.consumer.ConnectivityCheck,
-	}
+		TechnicalSummary: "Consuming messages is broken. Check if source proxy is reachable. The check reports the last request of the running consumer to the source proxy.",
+		Checker:          hc.consumer.check,
+	})
 }
 
 func (hc HealthCheck) proxyForwarderHealthcheck() fthealth.Check {
-	return fthealth.Check{
+	return hc.metadata.apply(forwardCheckKey, fthealth.Check{
 		BusinessImpact:   "Forwarding messages to kafka-proxy in coco won't work. Publishing in the containerised stack won't work.",
 		Name:             "Forward messages to kafka-proxy.",
 		PanicGuide:       "https://dewey.ft.com/kafka-bridge.html",
 		Severity:         1,
 		TechnicalSummary: "Forwarding messages is broken. Check if destination proxy is reachable.",
-		Checker:          hc.producer.ConnectivityCheck,
-	}
+		Checker:          hc.producer.check,
+	})
+}
+
+func (hc HealthCheck) multiDestinationForwarderHealthcheck() fthealth.Check {
+	return hc.metadata.apply(forwardCheckKey, fthealth.Check{
+		BusinessImpact:   "Forwarding messages to some or all of the destinations won't work. Publishing in the containerised stack may not work.",
+		Name:             "Forward messages to the " + hc.producerType + " destinations",
+		PanicGuide:       "https://dewey.ft.com/kafka-bridge.html",
+		Severity:         1,
+		TechnicalSummary: "Forwarding messages is broken for the destinations the bridge depends on. The check output lists the unreachable destinations.",
+		Checker:          hc.producer.check,
+	})
 }
 
 func (hc HealthCheck) httpForwarderHealthcheck() fthealth.Check {
-	return fthealth.Check{
+	return hc.metadata.apply(forwardCheckKey, fthealth.Check{
 		BusinessImpact:   "Forwarding messages to cms-notifier in coco won't work. Publishing in the containerised stack won't work.",
 		Name:             "Forward messages to cms-notifier",
 		PanicGuide:       "https://dewey.ft.com/kafka-bridge.html",
 		Severity:         1,
 		TechnicalSummary: "Forwarding messages is broken. Check networking, cluster reachability and/or cms-notifier state.",
-		Checker:          hc.producer.ConnectivityCheck,
+		Checker:          hc.producer.check,
+	})
+}
+
+func (hc HealthCheck) replicationLatencyHealthcheck() fthealth.Check {
+	return hc.metadata.apply(replicationLatencyCheckKey, fthealth.Check{
+		BusinessImpact:   "No business impact, this check only reports how long it takes for published content to be bridged.",
+		Name:             "Replication latency",
+		PanicGuide:       "https://dewey.ft.com/kafka-bridge.html",
+		Severity:         3,
+		TechnicalSummary: "Time between the Message-Timestamp of the recently forwarded messages and the bridge forwarding them.",
+		Checker:          hc.replicationLatencyCheck,
+	})
+}
+
+func (hc HealthCheck) replicationLatencyCheck() (string, error) {
+	if hc.replicationLatency == nil {
+		return "No messages have been forwarded yet.", nil
 	}
+	latency := hc.replicationLatency.Snapshot()
+	if latency.Count == 0 {
+		return "No messages have been forwarded yet.", nil
+	}
+	return fmt.Sprintf("p50: %.0fms, p99: %.0fms over the last %d forwarded messages.", latency.P50, latency.P99, latency.Samples), nil
+}
+
+func (hc HealthCheck) consumerLagHealthcheck() fthealth.Check {
+	return hc.metadata.apply(consumerLagCheckKey, fthealth.Check{
+		BusinessImpact:   "Publishes are bridged with a delay. Content published in the source cluster is not up to date in the destination cluster.",
+		Name:             "Consumer lag",
+		PanicGuide:       "https://dewey.ft.com/kafka-bridge.html",
+		Severity:         2,
+		TechnicalSummary: "The bridge is many messages behind the source topic, or has stopped consuming while the source topic has unread messages. Check if consuming or forwarding is slow or failing, and consider scaling the bridge out.",
+		Checker:          hc.consumerLag.check,
+	})
+}
+
+func (hc HealthCheck) lastForwardHealthcheck() fthealth.Check {
+	return hc.metadata.apply(lastForwardCheckKey, fthealth.Check{
+		BusinessImpact:   "Messages are consumed but not bridged. Publishing in the containerised stack won't work.",
+		Name:             "Last successful forward",
+		PanicGuide:       "https://dewey.ft.com/kafka-bridge.html",
+		Severity:         2,
+		TechnicalSummary: "Messages are being consumed but none of them could be forwarded recently. Check the bridge logs for forwarding errors.",
+		Checker:          hc.forwarding.check,
+	})
+}
+
+func (hc HealthCheck) errorRateHealthcheck() fthealth.Check {
+	return hc.metadata.apply(errorRateCheckKey, fthealth.Check{
+		BusinessImpact:   "Some of the bridged messages are lost. Content published in the source cluster may be missing from the destination cluster.",
+		Name:             "Forwarding error rate",
+		PanicGuide:       "https://dewey.ft.com/kafka-bridge.html",
+		Severity:         2,
+		TechnicalSummary: "Too many messages failed to be forwarded recently. Check the last errors in the check output and the state of the destination.",
+		Checker:          hc.errorRate.check,
+	})
 }
 
 func (hc HealthCheck) GTG() gtg.Status {
 	consumerCheck := func() gtg.Status {
-		return gtgCheck(hc.consumer.ConnectivityCheck)
+		return gtgCheck(hc.consumer.check)
 	}
 
 	producerCheck := func() gtg.Status {
-		return gtgCheck(hc.producer.ConnectivityCheck)
+		return gtgCheck(hc.producer.check)
 	}
 
-	return gtg.FailFastParallelCheck([]gtg.StatusChecker{
+	checks := []gtg.StatusChecker{
 		consumerCheck,
 		producerCheck,
-	})()
+	}
+
+	if hc.consumerLag != nil {
+		checks = append(checks, func() gtg.Status {
+			return gtgCheck(hc.consumerLag.criticalCheck)
+		})
+	}
+
+	return gtg.FailFastParallelCheck(checks)()
 }
 
 func gtgCheck(handler func() (string, error)) gtg.Status {
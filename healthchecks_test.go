@@ -6,10 +6,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/message-queue-go-producer/producer"
-	"github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/Financial-Times/service-status-go/buildinfo"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -49,23 +50,39 @@ func (c *mockConsumerInstance) ConnectivityCheck() (string, error) {
 
 func initializeHealthcheck(isProducerConnectionHealthy bool, isConsumerConnectionHealthy bool, producerType string) HealthCheck {
 	return HealthCheck{
-		consumer:     &mockConsumerInstance{isConnectionHealthy: isConsumerConnectionHealthy},
-		producer:     &mockProducerInstance{isConnectionHealthy: isProducerConnectionHealthy},
+		consumer:     refreshedCheck((&mockConsumerInstance{isConnectionHealthy: isConsumerConnectionHealthy}).ConnectivityCheck),
+		producer:     refreshedCheck((&mockProducerInstance{isConnectionHealthy: isProducerConnectionHealthy}).ConnectivityCheck),
 		producerType: producerType,
 	}
 }
 
+func refreshedCheck(checker func() (string, error)) *cachedCheck {
+	c := newCachedCheck(checker, time.Second, newFakeClock())
+	c.refresh()
+	return c
+}
+
 func TestNewHealthCheck(t *testing.T) {
 	hc := NewHealthCheck(
-		&consumer.QueueConfig{},
+		(&mockConsumerInstance{isConnectionHealthy: true}).ConnectivityCheck,
 		producer.NewMessageProducer(producer.MessageProducerConfig{}),
 		"proxy",
-		http.DefaultClient,
+		newMetricsRegistry(),
+		newConsumerLagMonitor((&stubEndOffsets{offsets: map[int32]int64{0: 0}}).read, (&stubEndOffsets{offsets: map[int32]int64{0: 0}}).assignments, 100, 1000, systemClock{}),
+		newForwardingMonitor(time.Minute, systemClock{}),
+		newErrorRateMonitor(time.Minute, 0.05, systemClock{}),
+		time.Minute,
+		time.Second,
+		healthCheckMetadata{},
 	)
 
 	assert.NotNil(t, hc.consumer)
 	assert.NotNil(t, hc.producer)
 	assert.Equal(t, "proxy", hc.producerType)
+	assert.NotNil(t, hc.replicationLatency)
+	assert.NotNil(t, hc.consumerLag)
+	assert.NotNil(t, hc.forwarding)
+	assert.NotNil(t, hc.errorRate)
 }
 
 func TestGTGHappyFlow(t *testing.T) {
@@ -81,7 +98,7 @@ func TestGTGBrokenConsumer(t *testing.T) {
 
 	status := hc.GTG()
 	assert.False(t, status.GoodToGo)
-	assert.Equal(t, "Error connecting to the queue", status.Message)
+	assert.Equal(t, "Error connecting to the queue (checked 0s ago)", status.Message)
 }
 
 func TestGTGCheckBrokenProducer(t *testing.T) {
@@ -89,7 +106,7 @@ func TestGTGCheckBrokenProducer(t *testing.T) {
 
 	status := hc.GTG()
 	assert.False(t, status.GoodToGo)
-	assert.Equal(t, "Error connecting to the queue", status.Message)
+	assert.Equal(t, "Error connecting to the queue (checked 0s ago)", status.Message)
 }
 
 func TestHealthHappyFlow(t *testing.T) {
@@ -109,6 +126,20 @@ func TestHealthHappyFlow(t *testing.T) {
 	}
 }
 
+func TestHealthDescriptionIncludesBuildInfo(t *testing.T) {
+	hc := initializeHealthcheck(true, true, plainHTTP)
+
+	req := httptest.NewRequest("GET", "http://example.com/__health", nil)
+	w := httptest.NewRecorder()
+	hc.Health("kafka-bridge")(w, req)
+
+	result := struct {
+		Description string `json:"description"`
+	}{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, "Services: source-kafka-proxy, cms-notifier. "+describeBuild(buildinfo.GetBuildInfo()), result.Description)
+}
+
 func TestHealthBrokenProxyProducer(t *testing.T) {
 	hc := initializeHealthcheck(false, true, proxy)
 
@@ -172,6 +203,93 @@ func TestHealthBrokenConsumer(t *testing.T) {
 	}
 }
 
+func TestHealthReportsReplicationLatency(t *testing.T) {
+	hc := initializeHealthcheck(true, true, proxy)
+	hc.replicationLatency = newHistogram(10)
+	for i := 1; i <= 4; i++ {
+		hc.replicationLatency.Observe(time.Duration(i) * time.Second)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/__health", nil)
+	w := httptest.NewRecorder()
+	hc.Health("kafka-bridge")(w, req)
+
+	checks, err := parseHealthcheck(w.Body.String())
+	assert.NoError(t, err)
+	found := false
+	for _, check := range checks {
+		if check.Name == "Replication latency" {
+			found = true
+			assert.True(t, check.Ok)
+			assert.Equal(t, "p50: 2000ms, p99: 4000ms over the last 4 forwarded messages.", check.CheckOutput)
+		}
+	}
+	assert.True(t, found, "Replication latency check should be reported")
+}
+
+func TestReplicationLatencyCheckWithoutMessages(t *testing.T) {
+	hc := initializeHealthcheck(true, true, proxy)
+
+	output, err := hc.replicationLatencyCheck()
+	assert.NoError(t, err)
+	assert.Equal(t, "No messages have been forwarded yet.", output)
+}
+
+func TestConsumerLag(t *testing.T) {
+	hc := initializeHealthcheck(true, true, proxy)
+	endOffsets := &stubEndOffsets{offsets: map[int32]int64{0: 0}}
+	hc.consumerLag = newConsumerLagMonitor(endOffsets.read, endOffsets.assignments, 100, 1000, systemClock{})
+	hc.consumerLag.refresh()
+
+	endOffsets.offsets = map[int32]int64{0: 500}
+	hc.consumerLag.refresh()
+
+	req := httptest.NewRequest("GET", "http://example.com/__health", nil)
+	w := httptest.NewRecorder()
+	hc.Health("kafka-bridge")(w, req)
+
+	checks, err := parseHealthcheck(w.Body.String())
+	assert.NoError(t, err)
+	for _, check := range checks {
+		if check.Name == "Consumer lag" {
+			assert.False(t, check.Ok)
+		} else {
+			assert.True(t, check.Ok)
+		}
+	}
+	assert.True(t, hc.GTG().GoodToGo, "Lag under the critical threshold should not affect GTG")
+
+	endOffsets.offsets = map[int32]int64{0: 5000}
+	hc.consumerLag.refresh()
+	assert.False(t, hc.GTG().GoodToGo)
+}
+
+func TestHealthWithCustomMetadata(t *testing.T) {
+	hc := initializeHealthcheck(false, true, plainHTTP)
+	hc.metadata = healthCheckMetadata{
+		checkMetadata: checkMetadata{Severity: 3},
+		Checks: map[string]checkMetadata{
+			forwardCheckKey: {Name: "Forward messages to staging cms-notifier"},
+		},
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/__health", nil)
+	w := httptest.NewRecorder()
+	hc.Health("kafka-bridge")(w, req)
+
+	checks, err := parseHealthcheck(w.Body.String())
+	assert.NoError(t, err)
+	found := false
+	for _, check := range checks {
+		assert.Equal(t, uint8(3), check.Severity)
+		if check.Name == "Forward messages to staging cms-notifier" {
+			found = true
+			assert.False(t, check.Ok)
+		}
+	}
+	assert.True(t, found, "Forward check should be renamed")
+}
+
 func parseHealthcheck(healthcheckJSON string) ([]fthealth.CheckResult, error) {
 	result := &struct {
 		Checks []fthealth.CheckResult `json:"checks"`
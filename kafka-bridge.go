@@ -1,9 +1,12 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"flag"
 	"net"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -12,17 +15,43 @@ import (
 	"github.com/Financial-Times/go-logger"
 	"github.com/Financial-Times/message-queue-go-producer/producer"
 	"github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/Financial-Times/service-status-go/buildinfo"
 	"github.com/Financial-Times/service-status-go/httphandlers"
 )
 
 // BridgeApp wraps the config and represents the API for the bridge
 type BridgeApp struct {
-	consumerConfig   *consumer.QueueConfig
-	producerConfig   *producer.MessageProducerConfig
-	producerInstance producer.MessageProducer
-	producerType     string
-	httpClient       *http.Client
-	serviceName      string
+	consumerConfig      *consumer.QueueConfig
+	producerConfig      *producer.MessageProducerConfig
+	producerInstance    producer.MessageProducer
+	producerType        string
+	httpClient          *http.Client
+	consumerObserver    *consumerObserver
+	serviceName         string
+	workerCount         int
+	workerQueueSize     int
+	coalesceWindow      time.Duration
+	metrics             *metricsRegistry
+	pipeline            *pipeline
+	consumerLag         *consumerLagMonitor
+	forwarding          *forwardingMonitor
+	errorRate           *errorRateMonitor
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+	healthCheckMetadata healthCheckMetadata
+	liveness            *livenessMonitor
+	started             time.Time
+	adminAddress        string
+	adminReadTimeout    time.Duration
+	adminWriteTimeout   time.Duration
+	controlAddress      string
+	controlWriteTimeout time.Duration
+	controlAuth         authenticator
+	controlTLS          *tls.Config
+	diagnosticsEnabled  bool
+	tracer              *tracer
+	traceExporter       *otlpExporter
+	dryRun              bool
 }
 
 const (
@@ -30,7 +59,7 @@ const (
 	proxy     = "proxy"
 )
 
-func newBridgeApp(consumerAddrs string, consumerGroupID string, consumerOffset string, consumerAutoCommitEnable bool, consumerAuthorizationKey string, topic string, producerAddress string, producerVulcanAuth string, producerType string, serviceName string) *BridgeApp {
+func newBridgeApp(consumerAddrs string, consumerGroupID string, consumerOffset string, consumerAutoCommitEnable bool, consumerAuthorizationKey string, topic string, producerAddress string, producerVulcanAuth string, producerType string, serviceName string, settings producerSettings) *BridgeApp {
 	consumerConfig := consumer.QueueConfig{}
 	consumerConfig.Addrs = strings.Split(consumerAddrs, ",")
 	consumerConfig.Group = consumerGroupID
@@ -44,14 +73,10 @@ func newBridgeApp(consumerAddrs string, consumerGroupID string, consumerOffset s
 	producerConfig.Topic = topic
 	producerConfig.Authorization = producerVulcanAuth
 
-	var producerInstance producer.MessageProducer
-	switch producerType {
-	case proxy:
-		producerInstance = producer.NewMessageProducer(producerConfig)
-	case plainHTTP:
-		producerInstance = newPlainHTTPMessageProducer(producerConfig)
-	default:
-		logger.Fatalf(nil, fmt.Errorf("Unknown producer type %s", producerType), "The provided producer type '%v' is invalid", producerType)
+	settings.Config = producerConfig
+	producerInstance, err := newProducer(producerType, settings)
+	if err != nil {
+		logger.Fatalf(nil, err, "Couldn't create the producer of type '%v'", producerType)
 	}
 
 	httpClient := &http.Client{
@@ -63,13 +88,23 @@ func newBridgeApp(consumerAddrs string, consumerGroupID string, consumerOffset s
 			}).Dial,
 		}}
 
+	consumerObserver := newConsumerObserver(&http.Transport{
+		MaxIdleConnsPerHost: 100,
+		Dial: (&net.Dialer{
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+	}, systemClock{})
+
 	bridgeApp := &BridgeApp{
 		consumerConfig:   &consumerConfig,
+		consumerObserver: consumerObserver,
 		producerConfig:   &producerConfig,
 		producerInstance: producerInstance,
 		producerType:     producerType,
 		httpClient:       httpClient,
 		serviceName:      serviceName,
+		metrics:          newMetricsRegistry(),
+		started:          time.Now(),
 	}
 	return bridgeApp
 }
@@ -86,30 +121,246 @@ func initBridgeApp() *BridgeApp {
 	producerAddress := flag.String("producer_address", "", "The address the messages are forwarded to.")
 
 	producerVulcanAuth := flag.String("producer_vulcan_auth", "", "Authentication string by which you access cms-notifier via vulcand.")
-	producerType := flag.String("producer_type", proxy, "Two possible values are accepted: proxy - if the requests are going through the kafka-proxy; or plainHTTP if a normal http request is required.")
+	producerType := flag.String("producer_type", proxy, "Where messages are forwarded to. "+describeProducerTypes())
 	serviceName := flag.String("service_name", "kafka-bridge", "The full name for the bridge app, like: `cms-kafka-bridge-pub-xp`")
+	workerCount := flag.Int("worker_count", 1, "Number of workers forwarding messages in parallel. Messages with the same kafka key are always forwarded in order. With more than one worker, the messages queued when the bridge crashes are lost.")
+	workerQueueSize := flag.Int("worker_queue_size", 10, "Number of messages each worker can hold before the consumer blocks.")
+	coalesceWindow := flag.Duration("coalesce_window", 0, "When set, messages for the same content UUID received within this window are coalesced and only the latest one is forwarded, e.g. `5s`. The offsets of the messages held back are committed before they are forwarded.")
+	stages := flag.String("stages", "tid,stale,transform", "Comma separated stages every message goes through, in order, before it is forwarded. "+describeStages())
+	transformScript := flag.String("transform_script", "", "Starlark script whose transform(message) function rewrites or drops every message in the transform stage.")
+	transformTimeout := flag.Duration("transform_timeout", 100*time.Millisecond, "Time after which the transform script is cancelled and the message fails.")
+	transformMaxSteps := flag.Uint64("transform_max_steps", 1000000, "Maximum number of Starlark execution steps the transform script can take for a message.")
+	staleMaxAge := flag.Duration("stale_max_age", 0, "When set, messages whose Message-Timestamp is older than this are treated as stale, e.g. `1h`.")
+	staleClockSkew := flag.Duration("stale_clock_skew", 30*time.Second, "Tolerated clock difference between the publishing system and the bridge when checking message age.")
+	staleAction := flag.String("stale_action", staleDrop, "What happens to stale messages: drop, deadletter (send them to -stale_dead_letter_topic) or tag (forward them with the X-Stale-Message header).")
+	staleDeadLetterAddress := flag.String("stale_dead_letter_address", "", "The kafka-proxy address stale messages are sent to when -stale_action=deadletter.")
+	staleDeadLetterTopic := flag.String("stale_dead_letter_topic", "", "The topic stale messages are sent to when -stale_action=deadletter.")
+	staleDeadLetterAuth := flag.String("stale_dead_letter_auth", "", "Authorization header of the requests to the dead letter kafka-proxy.")
+	lagWarningThreshold := flag.Int64("lag_warning_threshold", 1000, "Number of messages the consumer can be behind the source topic before the consumer lag healthcheck fails. 0 disables the threshold.")
+	lagCriticalThreshold := flag.Int64("lag_critical_threshold", 10000, "Number of messages the consumer can be behind the source topic before the bridge is no longer good to go. 0 disables the threshold.")
+	forwardQuietPeriod := flag.Duration("forward_quiet_period", 10*time.Minute, "How long messages can be consumed without any of them being forwarded successfully before the healthcheck fails.")
+	errorRateWindow := flag.Duration("error_rate_window", 5*time.Minute, "Sliding window over which the forwarding error rate is computed.")
+	errorRateThreshold := flag.Float64("error_rate_threshold", 0.05, "Share of failed forwards within the error rate window over which the healthcheck fails, e.g. 0.05 for 5%.")
+	healthCheckInterval := flag.Duration("healthcheck_interval", 15*time.Second, "How often the connectivity to the source and the destination is checked in the background.")
+	healthCheckTimeout := flag.Duration("healthcheck_timeout", 5*time.Second, "Time after which a connectivity check is reported as failed.")
+	healthCheckConfig := flag.String("healthcheck_config", "", `JSON overriding the name, severity, businessImpact, panicGuide and technicalSummary of the healthchecks, e.g. {"severity":3,"checks":{"consume":{"name":"Consume from staging"}}}.`)
+	livenessWatchdog := flag.Duration("liveness_watchdog", 2*time.Minute, "How long the consumer can go without polling kafka-proxy before /__live fails.")
+	shadowType := flag.String("shadow_type", plainHTTP, "Producer type of the shadow destination.")
+	shadowAddress := flag.String("shadow_address", "", "When set, a copy of every message is forwarded in the background to this shadow destination, and its responses are compared with the ones of the destination. The shadow never affects forwarding.")
+	shadowAuth := flag.String("shadow_auth", "", "Authorization header sent to the shadow destination. The one of -producer_vulcan_auth is never sent to the shadow.")
+
+	adminAddress := flag.String("admin_address", ":8080", "Address the healthchecks and the operational endpoints are served on.")
+	adminReadTimeout := flag.Duration("admin_read_timeout", 10*time.Second, "Maximum duration for reading a request to the admin endpoints.")
+	adminWriteTimeout := flag.Duration("admin_write_timeout", 30*time.Second, "Maximum duration for writing the response of the admin endpoints. Keep it above the 10s timeout of /__health.")
+	controlAddress := flag.String("control_address", "", "Address the authenticated control endpoints are served on, e.g. `:8081`. It must differ from -admin_address. Empty disables the control endpoints.")
+	controlWriteTimeout := flag.Duration("control_write_timeout", 5*time.Minute, "Maximum duration for writing the response of the control endpoints. Keep it above the duration of the CPU profiles and traces taken from /debug/pprof. 0 disables it.")
+	controlAuth := flag.String("control_auth", tokenAuth, "How requests to the control endpoints are authenticated: token (bearer token from -control_token_file), basic (user:password lines of -control_basic_auth_file) or cert (client certificates signed by -control_client_ca).")
+	controlTokenFile := flag.String("control_token_file", "", "File holding the bearer token of the control endpoints.")
+	controlBasicAuthFile := flag.String("control_basic_auth_file", "", "File holding the user:password lines allowed to call the control endpoints.")
+	controlTLSCert := flag.String("control_tls_cert", "", "TLS certificate file of the control endpoints. When set with -control_tls_key, they are served over HTTPS.")
+	controlTLSKey := flag.String("control_tls_key", "", "TLS key file of the control endpoints.")
+	controlClientCA := flag.String("control_client_ca", "", "CA file client certificates are verified against when -control_auth=cert.")
+	controlCertNames := flag.String("control_cert_names", "", "Comma separated common names of the client certificates allowed to call the control endpoints. Empty allows every certificate signed by the client CA.")
+	diagnosticsEnabled := flag.Bool("diagnostics_enabled", false, "Serve the /debug/pprof, /debug/goroutines and /debug/gc endpoints on the control address.")
+	tracingEndpoint := flag.String("tracing_endpoint", "", "Base URL of the OpenTelemetry collector the spans are exported to with OTLP/HTTP, e.g. `http://otel-collector:4318`. Empty disables tracing.")
+	tracingExportInterval := flag.Duration("tracing_export_interval", 5*time.Second, "How often the spans are exported to the OpenTelemetry collector.")
+	dryRun := flag.Bool("dry_run", false, "Consume, filter and map messages as usual, but log what would be forwarded instead of forwarding it. Stale messages aren't sent to the dead letter topic either.")
+	dryRunConsumerGroupID := flag.String("dry_run_consumer_group_id", "", "Kafka group id a dry run consumes with instead of -consumer_group_id. It is required with -dry_run and must differ from -consumer_group_id, so that the dry run doesn't take messages from the bridge nor commit offsets for it.")
+	printVersion := flag.Bool("version", false, "Print the version, git revision and build time of the binary and exit.")
+	producerOptions := declareProducerFlags(flag.CommandLine)
 
 	flag.Parse()
 
+	if *printVersion {
+		fmt.Println(describeBuild(buildinfo.GetBuildInfo()))
+		os.Exit(0)
+	}
+
 	logger.InitDefaultLogger(*serviceName)
 	logger.Infof(nil, "Starting Kafka Bridge")
 
-	return newBridgeApp(*consumerAddrs, *consumerGroup, *consumerOffset, *consumerAutoCommitEnable, *consumerAuthorizationKey, *topic, *producerAddress, *producerVulcanAuth, *producerType, *serviceName)
-}
+	if batch, ok := producerOptions[proxy].(*proxyBatchConfig); ok {
+		if err := checkBatchWorkers(*batch, *workerCount); err != nil {
+			logger.Fatalf(nil, err, "The provided batching settings are invalid")
+		}
+	}
+
+	group := *consumerGroup
+	if *dryRun {
+		dryRunGroup, err := dryRunConsumerGroup(*consumerGroup, *dryRunConsumerGroupID)
+		if err != nil {
+			logger.Fatalf(nil, err, "The provided dry run settings are invalid")
+		}
+		group = dryRunGroup
+	}
+	bridgeApp := newBridgeApp(*consumerAddrs, group, *consumerOffset, *consumerAutoCommitEnable, *consumerAuthorizationKey, *topic, *producerAddress, *producerVulcanAuth, *producerType, *serviceName, producerSettings{
+		Options: producerOptions,
+	})
+	if *shadowAddress != "" {
+		shadow, err := newShadowDestination(*shadowType, *shadowAddress, *shadowAuth, *bridgeApp.producerConfig, producerOptions)
+		if err != nil {
+			logger.Fatalf(nil, err, "The provided shadow destination is invalid")
+		}
+		bridgeApp.producerInstance = newShadowProducer(bridgeApp.producerInstance, shadow, bridgeApp.metrics)
+	}
+	bridgeApp.workerCount = *workerCount
+	bridgeApp.workerQueueSize = *workerQueueSize
+	bridgeApp.coalesceWindow = *coalesceWindow
+	bridgeApp.consumerLag = newConsumerLagMonitor(newEndOffsetsReader(bridgeApp.consumerConfig, bridgeApp.httpClient), newAssignmentsReader(bridgeApp.consumerObserver, bridgeApp.consumerConfig, bridgeApp.httpClient), *lagWarningThreshold, *lagCriticalThreshold, systemClock{})
+	bridgeApp.consumerObserver.lag = bridgeApp.consumerLag
+	bridgeApp.forwarding = newForwardingMonitor(*forwardQuietPeriod, systemClock{})
+	bridgeApp.errorRate = newErrorRateMonitor(*errorRateWindow, *errorRateThreshold, systemClock{})
+	bridgeApp.healthCheckInterval = *healthCheckInterval
+	bridgeApp.healthCheckTimeout = *healthCheckTimeout
+	bridgeApp.liveness = newLivenessMonitor(*livenessWatchdog, bridgeApp.consumerObserver.lastRequestTime, systemClock{})
+	bridgeApp.adminAddress = *adminAddress
+	bridgeApp.adminReadTimeout = *adminReadTimeout
+	bridgeApp.adminWriteTimeout = *adminWriteTimeout
+	bridgeApp.diagnosticsEnabled = *diagnosticsEnabled
+	bridgeApp.dryRun = *dryRun
+	if *controlAddress != "" {
+		if *controlAddress == *adminAddress {
+			logger.Fatalf(nil, errors.New("-control_address is the same as -admin_address"), "The control endpoints can't be served next to the public healthchecks")
+		}
+		auth, err := newAuthenticator(controlAuthConfig{
+			Method:           *controlAuth,
+			TokenFile:        *controlTokenFile,
+			BasicAuthFile:    *controlBasicAuthFile,
+			AllowedCertNames: splitNonEmpty(*controlCertNames),
+		})
+		if err != nil {
+			logger.Fatalf(nil, err, "The provided control endpoint authentication is invalid")
+		}
+		tlsConfig, err := newControlTLSConfig(*controlTLSCert, *controlTLSKey, *controlClientCA)
+		if err != nil {
+			logger.Fatalf(nil, err, "The provided control endpoint TLS settings are invalid")
+		}
+		if *controlAuth == clientCertAuth && (tlsConfig == nil || tlsConfig.ClientCAs == nil) {
+			logger.Fatalf(nil, errors.New("-control_auth=cert without -control_client_ca"), "Client certificate authentication requires TLS and a client CA")
+		}
+		bridgeApp.controlAddress = *controlAddress
+		bridgeApp.controlWriteTimeout = *controlWriteTimeout
+		bridgeApp.controlAuth = auth
+		bridgeApp.controlTLS = tlsConfig
+	} else if *diagnosticsEnabled {
+		logger.Fatalf(nil, errors.New("-control_address is empty"), "The diagnostics endpoints can only be served on the control address")
+	}
 
-func (bridgeApp *BridgeApp) enableHealthchecksAndGTG(serviceName string) {
-	hc := NewHealthCheck(bridgeApp.consumerConfig, bridgeApp.producerInstance, bridgeApp.producerType, bridgeApp.httpClient)
-	http.HandleFunc("/__health", hc.Health(serviceName))
-	http.HandleFunc(httphandlers.GTGPath, httphandlers.NewGoodToGoHandler(hc.GTG))
+	if *tracingEndpoint != "" {
+		bridgeApp.traceExporter = newOTLPExporter(strings.TrimSuffix(*tracingEndpoint, "/"), *serviceName, *tracingExportInterval)
+		bridgeApp.tracer = newTracer(bridgeApp.traceExporter, systemClock{})
+	}
 
-	err := http.ListenAndServe(":8080", nil)
+	healthCheckMetadata, err := parseHealthCheckMetadata(*healthCheckConfig)
 	if err != nil {
-		logger.Errorf(nil, err, "Couldn't set up HTTP listener for healthcheck")
+		logger.Fatalf(nil, err, "The provided healthcheck config is invalid")
+	}
+	bridgeApp.healthCheckMetadata = healthCheckMetadata
+
+	messagePipeline, err := newPipeline(splitNonEmpty(*stages), stageSettings{
+		Stale: staleSettings{
+			MaxAge:            *staleMaxAge,
+			ClockSkew:         *staleClockSkew,
+			Action:            *staleAction,
+			DeadLetterAddress: *staleDeadLetterAddress,
+			DeadLetterTopic:   *staleDeadLetterTopic,
+			Authorization:     *staleDeadLetterAuth,
+		},
+		Transform: transformSettings{
+			Script:   *transformScript,
+			Timeout:  *transformTimeout,
+			MaxSteps: *transformMaxSteps,
+		},
+		Metrics: bridgeApp.metrics,
+		DryRun:  *dryRun,
+	})
+	if err != nil {
+		logger.Fatalf(nil, err, "The provided stages are invalid")
+	}
+	bridgeApp.pipeline = messagePipeline
+	return bridgeApp
+}
+
+// splitNonEmpty splits a comma separated list, leaving out empty items.
+func splitNonEmpty(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
+}
+
+// adminRouter returns the routes of the admin server: the healthchecks and the probes, which must stay public.
+func (bridgeApp *BridgeApp) adminRouter() *http.ServeMux {
+	probe := newConsumerProbe(bridgeApp.consumerConfig, bridgeApp.httpClient)
+	consumerCheck := func() (string, error) {
+		return bridgeApp.consumerObserver.check(probe)
+	}
+	hc := NewHealthCheck(consumerCheck, bridgeApp.producerInstance, bridgeApp.producerType, bridgeApp.metrics, bridgeApp.consumerLag, bridgeApp.forwarding, bridgeApp.errorRate, bridgeApp.healthCheckInterval, bridgeApp.healthCheckTimeout, bridgeApp.healthCheckMetadata)
+
+	router := http.NewServeMux()
+	router.HandleFunc("/__health", hc.Health(bridgeApp.serviceName))
+	router.HandleFunc(httphandlers.GTGPath, httphandlers.NewGoodToGoHandler(hc.GTG))
+	router.HandleFunc(httphandlers.BuildInfoPath, httphandlers.BuildInfoHandler)
+	router.HandleFunc("/__live", bridgeApp.liveness.Live)
+	return router
+}
+
+// controlRouter returns the routes of the control server, every one of them requiring authentication. The status and
+// the metrics are served here, as they describe the config and the destinations of the bridge.
+func (bridgeApp *BridgeApp) controlRouter() *http.ServeMux {
+	router := http.NewServeMux()
+	router.Handle("/__metrics", requireAuth(bridgeApp.controlAuth, http.HandlerFunc(bridgeApp.metrics.Handler)))
+	router.Handle("/__status", requireAuth(bridgeApp.controlAuth, http.HandlerFunc(bridgeApp.Status)))
+	if bridgeApp.diagnosticsEnabled {
+		registerDiagnostics(router, bridgeApp.controlAuth)
+	}
+	return router
 }
 
 func main() {
 	bridgeApp := initBridgeApp()
-	go bridgeApp.enableHealthchecksAndGTG(bridgeApp.serviceName)
+
+	server, err := newAdminServer(bridgeApp.adminAddress, bridgeApp.adminReadTimeout, bridgeApp.adminWriteTimeout, nil, bridgeApp.adminRouter())
+	if err != nil {
+		logger.Fatalf(nil, err, "Couldn't set up HTTP listener for healthcheck")
+	}
+	go func() {
+		if err := server.serve(); err != nil {
+			logger.Fatalf(nil, err, "HTTP listener for healthcheck failed")
+		}
+	}()
+	logger.Infof(nil, "Serving healthchecks on %s", server.address())
+
+	var controlServer *adminServer
+	if bridgeApp.controlAddress != "" {
+		controlServer, err = newAdminServer(bridgeApp.controlAddress, bridgeApp.adminReadTimeout, bridgeApp.controlWriteTimeout, bridgeApp.controlTLS, bridgeApp.controlRouter())
+		if err != nil {
+			logger.Fatalf(nil, err, "Couldn't set up HTTP listener for control endpoints")
+		}
+		go func() {
+			if err := controlServer.serve(); err != nil {
+				logger.Fatalf(nil, err, "HTTP listener for control endpoints failed")
+			}
+		}()
+		logger.Infof(nil, "Serving control endpoints on %s", controlServer.address())
+	}
+
 	bridgeApp.consumeMessages()
+	stopProducer(bridgeApp.producerInstance)
+
+	if err := server.shutdown(adminShutdownTimeout); err != nil {
+		logger.Errorf(nil, err, "Couldn't shut down HTTP listener for healthcheck cleanly")
+	}
+	if controlServer != nil {
+		if err := controlServer.shutdown(adminShutdownTimeout); err != nil {
+			logger.Errorf(nil, err, "Couldn't shut down HTTP listener for control endpoints cleanly")
+		}
+	}
+	if bridgeApp.traceExporter != nil {
+		bridgeApp.traceExporter.stop()
+	}
+	logger.Infof(nil, "Kafka Bridge stopped")
 }
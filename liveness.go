@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// livenessMonitor tells whether the consumer loop is still alive: running, not panicked, and polling kafka-proxy.
+type livenessMonitor struct {
+	mutex    sync.Mutex
+	started  time.Time
+	running  bool
+	stopped  bool
+	panicked string
+	watchdog time.Duration
+	lastPoll func() time.Time
+	clock    clock
+}
+
+func newLivenessMonitor(watchdog time.Duration, lastPoll func() time.Time, clock clock) *livenessMonitor {
+	return &livenessMonitor{
+		watchdog: watchdog,
+		lastPoll: lastPoll,
+		clock:    clock,
+	}
+}
+
+func (l *livenessMonitor) consumerStarted() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.started = l.clock.now()
+	l.running = true
+}
+
+func (l *livenessMonitor) consumerStopped() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.running = false
+	l.stopped = true
+}
+
+func (l *livenessMonitor) consumerPanicked(reason interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.panicked == "" {
+		l.panicked = fmt.Sprintf("%v", reason)
+	}
+}
+
+// state describes the consumer loop: starting, running, stopped or panicked.
+func (l *livenessMonitor) state() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	switch {
+	case l.panicked != "":
+		return "panicked"
+	case l.stopped:
+		return "stopped"
+	case l.running:
+		return "running"
+	default:
+		return "starting"
+	}
+}
+
+// check fails when the consumer has stopped or panicked, or hasn't polled kafka-proxy within the watchdog interval.
+// Right after the consumer starts it is given the watchdog interval to make its first poll.
+func (l *livenessMonitor) check() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.panicked != "" {
+		return fmt.Errorf("Consumer panicked: %s", l.panicked)
+	}
+	if l.stopped {
+		return errors.New("Consumer has stopped.")
+	}
+	if !l.running {
+		return nil
+	}
+
+	lastActivity := l.lastPoll()
+	if lastActivity.Before(l.started) {
+		lastActivity = l.started
+	}
+	if silence := l.clock.now().Sub(lastActivity); silence > l.watchdog {
+		return fmt.Errorf("Consumer hasn't polled kafka-proxy for %v.", silence.Truncate(time.Second))
+	}
+	return nil
+}
+
+// Live is the handler of the liveness endpoint.
+func (l *livenessMonitor) Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=US-ASCII")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if err := l.check(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte("OK"))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/message-queue-go-producer/producer"
+	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLivenessWhilePolling(t *testing.T) {
+	clock := newFakeClock()
+	var lastPoll time.Time
+	l := newLivenessMonitor(2*time.Minute, func() time.Time { return lastPoll }, clock)
+
+	assert.NoError(t, l.check(), "The bridge should be live before the consumer starts")
+
+	l.consumerStarted()
+	clock.advance(time.Minute)
+	assert.NoError(t, l.check(), "The consumer should be given the watchdog interval to make its first poll")
+
+	lastPoll = clock.now()
+	clock.advance(90 * time.Second)
+	assert.NoError(t, l.check())
+}
+
+func TestLivenessFailures(t *testing.T) {
+	var tests = []struct {
+		name          string
+		sinceLastPoll time.Duration
+		stopped       bool
+		panics        []string
+		expectedError string
+	}{
+		{
+			name:          "watchdog",
+			sinceLastPoll: 4*time.Minute + 59*time.Second,
+			expectedError: "Consumer hasn't polled kafka-proxy for 4m59s.",
+		},
+		{
+			name:          "consumer stopped",
+			stopped:       true,
+			expectedError: "Consumer has stopped.",
+		},
+		{
+			name:          "consumer panicked",
+			panics:        []string{"runtime error: invalid memory address or nil pointer dereference", "a later panic"},
+			expectedError: "Consumer panicked: runtime error: invalid memory address or nil pointer dereference",
+		},
+	}
+
+	for _, test := range tests {
+		clock := newFakeClock()
+		lastPoll := clock.now()
+		l := newLivenessMonitor(2*time.Minute, func() time.Time { return lastPoll }, clock)
+
+		l.consumerStarted()
+		clock.advance(test.sinceLastPoll)
+		if test.stopped {
+			l.consumerStopped()
+		}
+		for _, reason := range test.panics {
+			l.consumerPanicked(reason)
+		}
+
+		assert.EqualError(t, l.check(), test.expectedError, test.name)
+	}
+}
+
+func TestLiveHandler(t *testing.T) {
+	clock := newFakeClock()
+	l := newLivenessMonitor(2*time.Minute, clock.now, clock)
+	l.consumerStarted()
+
+	w := httptest.NewRecorder()
+	l.Live(w, httptest.NewRequest("GET", "http://example.com/__live", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "OK", w.Body.String())
+
+	l.consumerStopped()
+	w = httptest.NewRecorder()
+	l.Live(w, httptest.NewRequest("GET", "http://example.com/__live", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "Consumer has stopped.", w.Body.String())
+}
+
+func timestampedTestMessage(timestamp time.Time) queueConsumer.Message {
+	return queueConsumer.Message{Headers: map[string]string{"Message-Timestamp": timestamp.Format(time.RFC3339Nano)}}
+}
+
+type panickingProducer struct {
+	mockProducerInstance
+}
+
+func (p *panickingProducer) SendMessage(string, producer.Message) error {
+	panic("producer panicked")
+}
+
+func TestRecoverForwardMsgMarksBridgeNotLive(t *testing.T) {
+	clock := newFakeClock()
+	bridge := BridgeApp{producerInstance: &panickingProducer{}, liveness: newLivenessMonitor(2*time.Minute, clock.now, clock)}
+
+	bridge.recoverForwardMsg(consumedMessage{Message: timestampedTestMessage(clock.now())})
+
+	assert.EqualError(t, bridge.liveness.check(), "Consumer panicked: producer panicked")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+)
+
+// messageCoalescer holds back messages for a content UUID during a window and passes on only the latest one.
+// Messages without a UUID in their body are passed on straight away. The messages held back are passed on from timer
+// goroutines, so next must hand them over to the workers rather than forward them itself.
+type messageCoalescer struct {
+	window     time.Duration
+	next       func(consumedMessage)
+	mutex      sync.Mutex
+	pending    map[string]*coalescedMessage
+	wg         sync.WaitGroup
+	superseded *counter
+}
+
+type coalescedMessage struct {
+	msg        consumedMessage
+	superseded []string
+	timer      *time.Timer
+}
+
+func newMessageCoalescer(window time.Duration, next func(consumedMessage), metrics *metricsRegistry) *messageCoalescer {
+	return &messageCoalescer{
+		window:     window,
+		next:       next,
+		pending:    make(map[string]*coalescedMessage),
+		superseded: metrics.counter(supersededMessagesMetric),
+	}
+}
+
+func (c *messageCoalescer) dispatch(msg consumedMessage) {
+	uuid := extractUUID(msg.Body)
+	if uuid == "" {
+		c.next(msg)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	p, found := c.pending[uuid]
+	if !found {
+		p = &coalescedMessage{msg: msg}
+		c.pending[uuid] = p
+		c.wg.Add(1)
+		p.timer = time.AfterFunc(c.window, func() { c.flush(uuid) })
+		return
+	}
+
+	if isNewerMessage(msg, p.msg) {
+		p.superseded = append(p.superseded, p.msg.Headers["X-Request-Id"])
+		p.msg = msg
+	} else {
+		p.superseded = append(p.superseded, msg.Headers["X-Request-Id"])
+	}
+	c.superseded.Inc()
+}
+
+func (c *messageCoalescer) flush(uuid string) {
+	c.mutex.Lock()
+	p := c.pending[uuid]
+	delete(c.pending, uuid)
+	c.mutex.Unlock()
+
+	c.forward(uuid, p)
+}
+
+func (c *messageCoalescer) forward(uuid string, p *coalescedMessage) {
+	defer c.wg.Done()
+	if len(p.superseded) > 0 {
+		logger.NewEntry(p.msg.Headers["X-Request-Id"]).WithUUID(uuid).
+			Info(fmt.Sprintf("Message supersedes %d earlier messages for the same content, which won't be forwarded: %s", len(p.superseded), strings.Join(p.superseded, ", ")))
+	}
+	c.next(p.msg)
+}
+
+// stop passes on every message still held back without waiting for its window to end.
+func (c *messageCoalescer) stop() {
+	c.mutex.Lock()
+	due := make(map[string]*coalescedMessage)
+	for uuid, p := range c.pending {
+		if p.timer.Stop() {
+			due[uuid] = p
+			delete(c.pending, uuid)
+		}
+	}
+	c.mutex.Unlock()
+
+	for uuid, p := range due {
+		c.forward(uuid, p)
+	}
+	c.wg.Wait()
+}
+
+// isNewerMessage compares the Message-Timestamp headers. If either is missing or invalid, the message consumed later wins.
+func isNewerMessage(candidate consumedMessage, current consumedMessage) bool {
+	candidateTime, err := extractTimestamp(candidate.Headers)
+	if err != nil {
+		return true
+	}
+	currentTime, err := extractTimestamp(current.Headers)
+	if err != nil {
+		return true
+	}
+	return !candidateTime.Before(currentTime)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingHandler struct {
+	mutex    sync.Mutex
+	messages []consumedMessage
+}
+
+func (h *recordingHandler) handle(msg consumedMessage) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.messages = append(h.messages, msg)
+}
+
+func (h *recordingHandler) tids() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var tids []string
+	for _, msg := range h.messages {
+		tids = append(tids, msg.Headers["X-Request-Id"])
+	}
+	return tids
+}
+
+func coalescerTestMessage(tid string, uuid string, timestamp string) consumedMessage {
+	return consumedMessage{Message: queueConsumer.Message{
+		Headers: map[string]string{"X-Request-Id": tid, "Message-Timestamp": timestamp},
+		Body:    `{"uuid":"` + uuid + `","value":"test"}`,
+	}}
+}
+
+func TestCoalescerForwardsLatestMessagePerUUID(t *testing.T) {
+	handler := &recordingHandler{}
+	coalescer := newMessageCoalescer(50*time.Millisecond, handler.handle, newMetricsRegistry())
+
+	coalescer.dispatch(coalescerTestMessage("tid_1", "7543220a-2389-11e5-bd83-71cb60e8f08c", "2015-07-06T07:03:09.362Z"))
+	coalescer.dispatch(coalescerTestMessage("tid_3", "7543220a-2389-11e5-bd83-71cb60e8f08c", "2015-07-06T07:03:11.362Z"))
+	coalescer.dispatch(coalescerTestMessage("tid_2", "7543220a-2389-11e5-bd83-71cb60e8f08c", "2015-07-06T07:03:10.362Z"))
+	coalescer.dispatch(coalescerTestMessage("tid_4", "9d1cdbd6-bd12-11e5-9fdb-87b8d15baec2", "2015-07-06T07:03:09.362Z"))
+
+	assert.Empty(t, handler.tids(), "Messages should be held back until the window ends")
+
+	time.Sleep(200 * time.Millisecond)
+	tids := handler.tids()
+	sort.Strings(tids)
+	assert.Equal(t, []string{"tid_3", "tid_4"}, tids)
+}
+
+// concurrencyProducer records the highest number of messages it was sent at the same time.
+type concurrencyProducer struct {
+	mockProducerInstance
+	mutex    sync.Mutex
+	inFlight int
+	max      int
+	tids     []string
+}
+
+func (p *concurrencyProducer) SendMessage(uuid string, message queueProducer.Message) error {
+	p.mutex.Lock()
+	p.inFlight++
+	if p.inFlight > p.max {
+		p.max = p.inFlight
+	}
+	p.mutex.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.inFlight--
+	p.tids = append(p.tids, message.Headers["X-Request-Id"])
+	return nil
+}
+
+func TestCoalescedMessagesAreForwardedByTheWorkers(t *testing.T) {
+	destination := &concurrencyProducer{}
+	bridge := BridgeApp{
+		producerInstance: destination,
+		metrics:          newMetricsRegistry(),
+		workerCount:      1,
+		workerQueueSize:  10,
+		coalesceWindow:   10 * time.Millisecond,
+	}
+	next, stop := bridge.newForwardingChain()
+
+	next(coalescerTestMessage("tid_1", "7543220a-2389-11e5-bd83-71cb60e8f08c", "2015-07-06T07:03:09.362Z"))
+	next(coalescerTestMessage("tid_2", "7543220a-2389-11e5-bd83-71cb60e8f08c", "2015-07-06T07:03:10.362Z"))
+	next(coalescerTestMessage("tid_3", "9d1cdbd6-bd12-11e5-9fdb-87b8d15baec2", "2015-07-06T07:03:09.362Z"))
+	next(coalescerTestMessage("tid_4", "2cb2ffe8-9b8a-4cd6-aac2-4a6a7b4e2f87", "2015-07-06T07:03:09.362Z"))
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	sort.Strings(destination.tids)
+	assert.Equal(t, []string{"tid_2", "tid_3", "tid_4"}, destination.tids)
+	assert.Equal(t, 1, destination.max, "A single worker forwards the coalesced messages one at a time")
+	assert.Equal(t, int64(1), bridge.metrics.counter(supersededMessagesMetric).Count())
+}
+
+func TestCoalescerPassesOnMessagesWithoutUUID(t *testing.T) {
+	handler := &recordingHandler{}
+	coalescer := newMessageCoalescer(time.Hour, handler.handle, newMetricsRegistry())
+
+	coalescer.dispatch(consumedMessage{Message: queueConsumer.Message{Headers: map[string]string{"X-Request-Id": "tid_1"}, Body: "not json"}})
+
+	assert.Equal(t, []string{"tid_1"}, handler.tids())
+}
+
+func TestCoalescerStopForwardsPendingMessages(t *testing.T) {
+	handler := &recordingHandler{}
+	coalescer := newMessageCoalescer(time.Hour, handler.handle, newMetricsRegistry())
+
+	coalescer.dispatch(coalescerTestMessage("tid_1", "7543220a-2389-11e5-bd83-71cb60e8f08c", "2015-07-06T07:03:09.362Z"))
+	coalescer.dispatch(coalescerTestMessage("tid_2", "7543220a-2389-11e5-bd83-71cb60e8f08c", "2015-07-06T07:03:10.362Z"))
+	coalescer.stop()
+
+	assert.Equal(t, []string{"tid_2"}, handler.tids())
+}
+
+func TestIsNewerMessage(t *testing.T) {
+	var tests = []struct {
+		candidate string
+		current   string
+		expected  bool
+	}{
+		{"2015-07-06T07:03:10.362Z", "2015-07-06T07:03:09.362Z", true},
+		{"2015-07-06T07:03:09.362Z", "2015-07-06T07:03:10.362Z", false},
+		{"2015-07-06T07:03:09.362Z", "2015-07-06T07:03:09.362Z", true},
+		{"", "2015-07-06T07:03:10.362Z", true},
+		{"2015-07-06T07:03:09.362Z", "invalid", true},
+	}
+
+	for _, test := range tests {
+		candidate := consumedMessage{Message: queueConsumer.Message{Headers: map[string]string{"Message-Timestamp": test.candidate}}}
+		current := consumedMessage{Message: queueConsumer.Message{Headers: map[string]string{"Message-Timestamp": test.current}}}
+		assert.Equal(t, test.expected, isNewerMessage(candidate, current), "Candidate: %s, current: %s", test.candidate, test.current)
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"net"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -9,21 +9,30 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/Financial-Times/go-logger"
 	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
 )
 
+// consumedMessage is a message on its way from the consumer to the producer, with what was known about it when it was consumed.
+type consumedMessage struct {
+	queueConsumer.Message
+	key      string
+	consumed time.Time
+}
+
 func (bridge BridgeApp) consumeMessages() {
 	consumerConfig := bridge.consumerConfig
+	next, stop := bridge.newForwardingChain()
+
+	handler := func(msg queueConsumer.Message) {
+		bridge.observeConsumed(msg)
+		next(consumedMessage{Message: msg, key: bridge.consumerObserver.messageKey(msg), consumed: time.Now()})
+	}
 
-	consumer := queueConsumer.NewAgeingConsumer(*consumerConfig, bridge.forwardMsg, queueConsumer.AgeingClient{
+	consumer := queueConsumer.NewAgeingConsumer(*consumerConfig, handler, queueConsumer.AgeingClient{
 		Client: &http.Client{
-			Timeout: 60 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConnsPerHost: 100,
-				Dial: (&net.Dialer{
-					KeepAlive: 30 * time.Second,
-				}).Dial,
-			},
+			Timeout:   60 * time.Second,
+			Transport: bridge.consumerObserver,
 		},
 		MaxAge: time.Duration(2) * time.Minute,
 	})
@@ -32,13 +41,70 @@ func (bridge BridgeApp) consumeMessages() {
 	wg.Add(1)
 
 	go func() {
+		defer wg.Done()
+		defer bridge.liveness.consumerStopped()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Errorf(nil, fmt.Errorf("%v", r), "Consumer panicked")
+				bridge.liveness.consumerPanicked(r)
+			}
+		}()
+		bridge.liveness.consumerStarted()
 		consumer.Start()
-		wg.Done()
 	}()
 
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
 	<-ch
 	consumer.Stop()
 	wg.Wait()
+	stop()
+}
+
+// newForwardingChain returns the function the consumed messages are handed over to, and the function forwarding the
+// messages still held back or queued once the consumer stopped.
+func (bridge BridgeApp) newForwardingChain() (func(consumedMessage), func()) {
+	// A single worker forwards messages in the consumer handler itself, so that gonsumer only commits the offsets of
+	// forwarded messages. With more workers, or when coalescing, the messages queued when the bridge crashes are lost.
+	// The coalescer passes messages on from its timers, so it always hands them over to the workers, which keep
+	// forwarding bounded and in order.
+	next := bridge.recoverForwardMsg
+	var dispatcher *messageDispatcher
+	if bridge.workerCount > 1 || bridge.coalesceWindow > 0 {
+		dispatcher = newMessageDispatcher(bridge.workerCount, bridge.workerQueueSize, bridge.recoverForwardMsg)
+		next = dispatcher.dispatch
+	}
+
+	var coalescer *messageCoalescer
+	if bridge.coalesceWindow > 0 {
+		coalescer = newMessageCoalescer(bridge.coalesceWindow, next, bridge.metrics)
+		next = coalescer.dispatch
+	}
+
+	return next, func() {
+		if coalescer != nil {
+			coalescer.stop()
+		}
+		if dispatcher != nil {
+			dispatcher.stop()
+		}
+	}
+}
+
+func (bridge BridgeApp) observeConsumed(msg queueConsumer.Message) {
+	bridge.metrics.counter(consumedMessagesMetric).Inc()
+	if bridge.forwarding != nil {
+		bridge.forwarding.consumed()
+	}
+}
+
+// recoverForwardMsg forwards the message, turning a panic into a failed liveness check instead of a crash of the worker.
+func (bridge BridgeApp) recoverForwardMsg(msg consumedMessage) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf(nil, fmt.Errorf("%v", r), "Forwarding message panicked")
+			bridge.liveness.consumerPanicked(r)
+		}
+	}()
+	bridge.forwardMsg(msg)
 }
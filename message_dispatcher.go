@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+)
+
+// messageDispatcher spreads consumed messages over a fixed pool of workers.
+// Messages sharing an ordering key always land on the same worker, so they are forwarded in the order they were consumed.
+type messageDispatcher struct {
+	queues  []chan consumedMessage
+	handler func(consumedMessage)
+	wg      sync.WaitGroup
+}
+
+func newMessageDispatcher(workerCount int, queueSize int, handler func(consumedMessage)) *messageDispatcher {
+	if workerCount < 1 {
+		workerCount = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	d := &messageDispatcher{
+		queues:  make([]chan consumedMessage, workerCount),
+		handler: handler,
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan consumedMessage, queueSize)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+	return d
+}
+
+func (d *messageDispatcher) work(queue chan consumedMessage) {
+	defer d.wg.Done()
+	for msg := range queue {
+		d.handler(msg)
+	}
+}
+
+// dispatch hands the message to the worker owning its ordering key. It blocks while that worker's queue is full,
+// which pushes back on the consumer instead of buffering without bound.
+func (d *messageDispatcher) dispatch(msg consumedMessage) {
+	d.queues[d.workerIndex(orderingKey(msg))] <- msg
+}
+
+// stop waits for every queued message to be handled. No message may be dispatched after stop is called.
+func (d *messageDispatcher) stop() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
+
+func (d *messageDispatcher) workerIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+// orderingKey returns the kafka key of the message, falling back to the content UUID and then to the Message-Id header.
+func orderingKey(msg consumedMessage) string {
+	if msg.key != "" {
+		return msg.key
+	}
+	if uuid := extractUUID(msg.Body); uuid != "" {
+		return uuid
+	}
+	return msg.Headers["Message-Id"]
+}
+
+func extractUUID(body string) string {
+	content := struct {
+		UUID string `json:"uuid"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &content); err != nil {
+		return ""
+	}
+	return content.UUID
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatcherKeepsOrderPerUUID(t *testing.T) {
+	var mutex sync.Mutex
+	received := make(map[string][]string)
+
+	dispatcher := newMessageDispatcher(4, 2, func(msg consumedMessage) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		uuid := extractUUID(msg.Body)
+		received[uuid] = append(received[uuid], msg.Headers["X-Request-Id"])
+	})
+
+	uuids := []string{
+		"7543220a-2389-11e5-bd83-71cb60e8f08c",
+		"9d1cdbd6-bd12-11e5-9fdb-87b8d15baec2",
+		"0e0a5b44-1c3d-11e6-b286-cddde55ca122",
+	}
+	for i := 0; i < 50; i++ {
+		for _, uuid := range uuids {
+			dispatcher.dispatch(consumedMessage{Message: queueConsumer.Message{
+				Headers: map[string]string{"X-Request-Id": fmt.Sprintf("tid_%d", i)},
+				Body:    fmt.Sprintf(`{"uuid":"%s","value":"test"}`, uuid),
+			}})
+		}
+	}
+	dispatcher.stop()
+
+	for _, uuid := range uuids {
+		assert.Len(t, received[uuid], 50)
+		for i, tid := range received[uuid] {
+			assert.Equal(t, fmt.Sprintf("tid_%d", i), tid, "Messages for %s were forwarded out of order", uuid)
+		}
+	}
+}
+
+func TestDispatcherHandlesMessagesWithoutUUID(t *testing.T) {
+	var mutex sync.Mutex
+	var handled int
+
+	dispatcher := newMessageDispatcher(0, 0, func(msg consumedMessage) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		handled++
+	})
+
+	dispatcher.dispatch(consumedMessage{Message: queueConsumer.Message{Headers: map[string]string{"Message-Id": "fc429b46-2500-4fe7-88bb-fd507fbaf00c"}, Body: "not json"}})
+	dispatcher.dispatch(consumedMessage{Message: queueConsumer.Message{Headers: map[string]string{}, Body: `{"type":"EOM::CompoundStory"}`}})
+	dispatcher.stop()
+
+	assert.Equal(t, 2, handled)
+}
+
+func TestOrderingKey(t *testing.T) {
+	var tests = []struct {
+		msg         consumedMessage
+		expectedKey string
+	}{
+		{
+			consumedMessage{
+				Message: queueConsumer.Message{
+					Headers: map[string]string{"Message-Id": "fc429b46-2500-4fe7-88bb-fd507fbaf00c"},
+					Body:    `{"uuid":"7543220a-2389-11e5-bd83-71cb60e8f08c","type":"EOM::CompoundStory","value":"test"}`,
+				},
+				key: "9d1cdbd6-bd12-11e5-9fdb-87b8d15baec2",
+			},
+			"9d1cdbd6-bd12-11e5-9fdb-87b8d15baec2",
+		},
+		{
+			consumedMessage{Message: queueConsumer.Message{
+				Headers: map[string]string{"Message-Id": "fc429b46-2500-4fe7-88bb-fd507fbaf00c"},
+				Body:    `{"uuid":"7543220a-2389-11e5-bd83-71cb60e8f08c","type":"EOM::CompoundStory","value":"test"}`,
+			}},
+			"7543220a-2389-11e5-bd83-71cb60e8f08c",
+		},
+		{
+			consumedMessage{Message: queueConsumer.Message{
+				Headers: map[string]string{"Message-Id": "fc429b46-2500-4fe7-88bb-fd507fbaf00c"},
+				Body:    `{"type":"EOM::CompoundStory","value":"test"}`,
+			}},
+			"fc429b46-2500-4fe7-88bb-fd507fbaf00c",
+		},
+		{
+			consumedMessage{Message: queueConsumer.Message{
+				Headers: map[string]string{"Message-Id": "fc429b46-2500-4fe7-88bb-fd507fbaf00c"},
+				Body:    `<xml/>`,
+			}},
+			"fc429b46-2500-4fe7-88bb-fd507fbaf00c",
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expectedKey, orderingKey(test.msg))
+	}
+}
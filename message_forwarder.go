@@ -2,27 +2,139 @@ package main
 
 import (
 	"errors"
+	"time"
+
 	"github.com/Financial-Times/go-logger"
 	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
-	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
 	"github.com/dchest/uniuri"
 )
 
-const tidValidRegexp = "(tid|SYNTHETIC-REQ-MON)[a-zA-Z0-9_-]*$"
+const (
+	tidValidRegexp         = "(tid|SYNTHETIC-REQ-MON)[a-zA-Z0-9_-]*$"
+	messageTimestampHeader = "Message-Timestamp"
+	tidStageName           = "tid"
+	failedOutcome          = "failed"
+)
+
+func init() {
+	registerStage(stageFactory{
+		Name:        tidStageName,
+		Description: "Keeps the transaction id of the X-Request-Id header, or generates one when it is missing. It must be the first stage.",
+		New: func(settings stageSettings) (messageStage, error) {
+			return tidStage{}, nil
+		},
+	})
+}
+
+func (bridge BridgeApp) forwardMsg(msg consumedMessage) {
+	span := bridge.startForwardSpan(msg)
+	defer span.finish()
 
-func (bridge BridgeApp) forwardMsg(msg queueConsumer.Message) {
-	tid, err := extractTID(msg.Headers)
+	if traceparent := span.traceparent(); traceparent != "" {
+		msg.Headers[traceparentHeader] = traceparent
+	}
+	message := queueProducer.Message{Headers: msg.Headers, Body: msg.Body}
+	err := bridge.pipeline.process(&message)
+	tid := message.Headers["X-Request-Id"]
+	span.setAttribute(tidAttribute, tid)
+	span.setAttribute(uuidAttribute, extractUUID(message.Body))
+	if drop, ok := err.(*stageDrop); ok {
+		bridge.observeOutcome(span, drop.outcome)
+		return
+	}
 	if err != nil {
-		tid = "tid_" + uniuri.NewLen(10) + "_kafka_bridge"
-		logger.NewEntry(tid).Info("Couldn't extract transaction id, due to %s. TID was generated.", err.Error())
+		logger.NewMonitoringEntry("Forwarding", tid, "").Error("Error happened before message forwarding: " + err.Error())
+		bridge.observeOutcome(span, failedOutcome)
+		span.setError(err)
+		bridge.observeFailure(tid, err)
+		return
+	}
+
+	if bridge.dryRun {
+		bridge.observeOutcome(span, "dry-run")
+		bridge.observeDryRun(tid, message)
+		return
+	}
+	err = bridge.producerInstance.SendMessage("", message)
+	if err == errMessageDropped {
+		bridge.observeOutcome(span, "dropped")
+		bridge.metrics.counter(droppedMessagesMetric).Inc()
+		return
 	}
-	msg.Headers["X-Request-Id"] = tid
-	err = bridge.producerInstance.SendMessage("", queueProducer.Message{Headers: msg.Headers, Body: msg.Body})
 	if err != nil {
 		logger.NewMonitoringEntry("Forwarding", tid, "").Error("Error happened during message forwarding: " + err.Error())
+		bridge.observeOutcome(span, failedOutcome)
+		span.setError(err)
+		bridge.observeFailure(tid, err)
 	} else {
 		logger.NewMonitoringEntry("Forwarding", tid, "").Info("Message has been forwarded")
+		bridge.observeOutcome(span, "forwarded")
+		bridge.observeForwarded(message.Headers)
+	}
+}
+
+// observeOutcome records how forwarding the message ended on its span. Every outcome but a failure means the message was
+// handled as configured, forwarded or deliberately not, which keeps the last forward healthcheck from failing when e.g.
+// every consumed message is stale or dropped by a router.
+func (bridge BridgeApp) observeOutcome(span *span, outcome string) {
+	span.setAttribute(outcomeAttribute, outcome)
+	if outcome != failedOutcome && bridge.forwarding != nil {
+		bridge.forwarding.handled()
+	}
+}
+
+// tidStage makes sure the message has a transaction id in its X-Request-Id header.
+type tidStage struct{}
+
+func (tidStage) process(message *queueProducer.Message) error {
+	tid, err := extractTID(message.Headers)
+	if err != nil {
+		tid = "tid_" + uniuri.NewLen(10) + "_kafka_bridge"
+		logger.NewEntry(tid).Infof("Couldn't extract transaction id, due to %s. TID was generated.", err.Error())
+	}
+	message.Headers["X-Request-Id"] = tid
+	return nil
+}
+
+// startForwardSpan starts the span of forwarding the message, continuing the trace of its traceparent header. The span
+// starts when the message was consumed, so that it covers the time the message waited for a worker. Without tracing it
+// returns nil.
+func (bridge BridgeApp) startForwardSpan(msg consumedMessage) *span {
+	if bridge.tracer == nil {
+		return nil
+	}
+	span := bridge.tracer.startSpanAt("forward "+bridge.consumerConfig.Topic, msg.Headers[traceparentHeader], msg.consumed)
+	span.setAttribute(topicAttribute, bridge.consumerConfig.Topic)
+	span.setAttribute(producerTypeAttribute, bridge.producerType)
+	return span
+}
+
+func (bridge BridgeApp) observeFailure(tid string, err error) {
+	bridge.metrics.counter(failedMessagesMetric).Inc()
+	if bridge.errorRate != nil {
+		bridge.errorRate.failure(tid, err)
+	}
+}
+
+func (bridge BridgeApp) observeForwarded(headers map[string]string) {
+	bridge.metrics.counter(forwardedMessagesMetric).Inc()
+	if bridge.errorRate != nil {
+		bridge.errorRate.success()
 	}
+	bridge.observeReplicationLatency(headers)
+}
+
+// observeReplicationLatency records the time between the message being published and it being forwarded by the bridge.
+func (bridge BridgeApp) observeReplicationLatency(headers map[string]string) {
+	timestamp, err := extractTimestamp(headers)
+	if err != nil {
+		return
+	}
+	latency := time.Since(timestamp)
+	if latency < 0 {
+		latency = 0
+	}
+	bridge.metrics.histogram(replicationLatencyMetric).Observe(latency)
 }
 
 func extractTID(headers map[string]string) (string, error) {
@@ -32,3 +144,7 @@ func extractTID(headers map[string]string) (string, error) {
 	}
 	return header, nil
 }
+
+func extractTimestamp(headers map[string]string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, headers[messageTimestampHeader])
+}
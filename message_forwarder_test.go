@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestExtractTID(t *testing.T) {
@@ -90,3 +91,19 @@ func TestExtractTID_TIDRegexp(t *testing.T) {
 		}
 	}
 }
+
+func TestObserveReplicationLatency(t *testing.T) {
+	bridge := BridgeApp{metrics: newMetricsRegistry()}
+
+	bridge.observeReplicationLatency(map[string]string{"Message-Timestamp": time.Now().Add(-time.Minute).Format(time.RFC3339Nano)})
+	bridge.observeReplicationLatency(map[string]string{"Message-Timestamp": "invalid"})
+	bridge.observeReplicationLatency(map[string]string{})
+
+	latency := bridge.metrics.histogram(replicationLatencyMetric).Snapshot()
+	if latency.Count != 1 {
+		t.Errorf("\nExpected: 1 latency observation\nActual: %d", latency.Count)
+	}
+	if latency.Min < float64(time.Minute/time.Millisecond) {
+		t.Errorf("\nExpected latency of at least a minute\nActual: %.0fms", latency.Min)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	histogramSampleSize = 1028
+
+	consumedMessagesMetric   = "messages_consumed"
+	forwardedMessagesMetric  = "messages_forwarded"
+	failedMessagesMetric     = "messages_failed"
+	droppedMessagesMetric    = "messages_dropped"
+	supersededMessagesMetric = "messages_superseded"
+	messageAgeMetric         = "message_age"
+	staleMessagesMetric      = "stale_messages"
+	replicationLatencyMetric = "replication_latency"
+)
+
+// metricsRegistry holds the bridge's counters and histograms and serves them as JSON.
+type metricsRegistry struct {
+	mutex      sync.Mutex
+	counters   map[string]*counter
+	histograms map[string]*histogram
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		counters:   make(map[string]*counter),
+		histograms: make(map[string]*histogram),
+	}
+}
+
+// counter returns the counter registered under name, creating it on first use.
+func (r *metricsRegistry) counter(name string) *counter {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	c, found := r.counters[name]
+	if !found {
+		c = &counter{}
+		r.counters[name] = c
+	}
+	return c
+}
+
+// histogram returns the histogram registered under name, creating it on first use.
+func (r *metricsRegistry) histogram(name string) *histogram {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	h, found := r.histograms[name]
+	if !found {
+		h = newHistogram(histogramSampleSize)
+		r.histograms[name] = h
+	}
+	return h
+}
+
+// Handler returns the current value of every metric.
+func (r *metricsRegistry) Handler(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	snapshot := make(map[string]interface{}, len(r.counters)+len(r.histograms))
+	for name, c := range r.counters {
+		snapshot[name] = c.Count()
+	}
+	for name, h := range r.histograms {
+		snapshot[name] = h.Snapshot()
+	}
+	r.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+type counter struct {
+	count int64
+}
+
+func (c *counter) Inc() {
+	atomic.AddInt64(&c.count, 1)
+}
+
+func (c *counter) Count() int64 {
+	return atomic.LoadInt64(&c.count)
+}
+
+// histogram keeps the most recent observations, in milliseconds, to compute percentiles from.
+type histogram struct {
+	mutex   sync.Mutex
+	samples []float64
+	next    int
+	count   int64
+}
+
+type histogramSnapshot struct {
+	Count   int64   `json:"count"`
+	Samples int     `json:"samples"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Mean    float64 `json:"mean"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+}
+
+func newHistogram(size int) *histogram {
+	return &histogram{samples: make([]float64, 0, size)}
+}
+
+func (h *histogram) Observe(d time.Duration) {
+	value := float64(d) / float64(time.Millisecond)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.count++
+	if len(h.samples) < cap(h.samples) {
+		h.samples = append(h.samples, value)
+		return
+	}
+	h.samples[h.next] = value
+	h.next = (h.next + 1) % len(h.samples)
+}
+
+// Snapshot summarises the retained samples. Count is the number of observations since start-up, Samples the number retained.
+func (h *histogram) Snapshot() histogramSnapshot {
+	h.mutex.Lock()
+	samples := make([]float64, len(h.samples))
+	copy(samples, h.samples)
+	count := h.count
+	h.mutex.Unlock()
+
+	snapshot := histogramSnapshot{Count: count, Samples: len(samples)}
+	if len(samples) == 0 {
+		return snapshot
+	}
+
+	sort.Float64s(samples)
+	var sum float64
+	for _, s := range samples {
+		sum += s
+	}
+	snapshot.Min = samples[0]
+	snapshot.Max = samples[len(samples)-1]
+	snapshot.Mean = sum / float64(len(samples))
+	snapshot.P50 = percentile(samples, 0.5)
+	snapshot.P95 = percentile(samples, 0.95)
+	snapshot.P99 = percentile(samples, 0.99)
+	return snapshot
+}
+
+// percentile expects the samples sorted in ascending order.
+func percentile(samples []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(samples)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return samples[rank]
+}
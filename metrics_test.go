@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramSnapshot(t *testing.T) {
+	h := newHistogram(100)
+	for i := 1; i <= 100; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	snapshot := h.Snapshot()
+	assert.Equal(t, int64(100), snapshot.Count)
+	assert.Equal(t, float64(1), snapshot.Min)
+	assert.Equal(t, float64(100), snapshot.Max)
+	assert.Equal(t, 50.5, snapshot.Mean)
+	assert.Equal(t, float64(50), snapshot.P50)
+	assert.Equal(t, float64(95), snapshot.P95)
+	assert.Equal(t, float64(99), snapshot.P99)
+}
+
+func TestHistogramKeepsMostRecentSamples(t *testing.T) {
+	h := newHistogram(10)
+	for i := 1; i <= 20; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	snapshot := h.Snapshot()
+	assert.Equal(t, int64(20), snapshot.Count)
+	assert.Equal(t, 10, snapshot.Samples)
+	assert.Equal(t, float64(11), snapshot.Min)
+	assert.Equal(t, float64(20), snapshot.Max)
+}
+
+func TestEmptyHistogramSnapshot(t *testing.T) {
+	assert.Equal(t, histogramSnapshot{}, newHistogram(10).Snapshot())
+}
+
+func TestMetricsHandler(t *testing.T) {
+	metrics := newMetricsRegistry()
+	metrics.counter("stale_messages").Inc()
+	metrics.counter("stale_messages").Inc()
+	metrics.histogram("message_age").Observe(time.Second)
+
+	w := httptest.NewRecorder()
+	metrics.Handler(w, httptest.NewRequest("GET", "http://example.com/__metrics", nil))
+
+	result := struct {
+		StaleMessages int64             `json:"stale_messages"`
+		MessageAge    histogramSnapshot `json:"message_age"`
+	}{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, int64(2), result.StaleMessages)
+	assert.Equal(t, int64(1), result.MessageAge.Count)
+	assert.Equal(t, float64(1000), result.MessageAge.P99)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+)
+
+const (
+	otlpTracesPath       = "/v1/traces"
+	otlpQueueSize        = 2048
+	otlpMaxBatchSize     = 512
+	otlpSpanKindConsumer = 5
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+// otlpExporter sends the spans in batches to an OpenTelemetry collector, using OTLP over HTTP with JSON encoding.
+// Spans are dropped rather than slowing forwarding down when the collector can't keep up.
+type otlpExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+	interval    time.Duration
+	spans       chan *span
+	stopping    chan struct{}
+	stopped     chan struct{}
+}
+
+func newOTLPExporter(endpoint string, serviceName string, interval time.Duration) *otlpExporter {
+	e := &otlpExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		interval:    interval,
+		spans:       make(chan *span, otlpQueueSize),
+		stopping:    make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *otlpExporter) export(s *span) {
+	select {
+	case e.spans <- s:
+	default:
+	}
+}
+
+// stop sends the spans which are still queued.
+func (e *otlpExporter) stop() {
+	close(e.stopping)
+	<-e.stopped
+}
+
+func (e *otlpExporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	var batch []*span
+	for {
+		select {
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) >= otlpMaxBatchSize {
+				e.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = nil
+		case <-e.stopping:
+			for {
+				select {
+				case s := <-e.spans:
+					batch = append(batch, s)
+				default:
+					e.send(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *otlpExporter) send(batch []*span) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := e.post(batch); err != nil {
+		logger.Errorf(nil, err, "Couldn't export %d spans", len(batch))
+	}
+}
+
+func (e *otlpExporter) post(batch []*span) error {
+	body, err := json.Marshal(e.request(batch))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.endpoint+otlpTracesPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Request to OTLP collector %s failed. Status: %d", e.endpoint, resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLP/JSON request, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *otlpExporter) request(batch []*span) otlpTraceRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		spans = append(spans, toOTLPSpan(s))
+	}
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue{StringValue: e.serviceName}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/Financial-Times/coco-kafka-bridge"},
+			Spans: spans,
+		}},
+	}}}
+}
+
+func toOTLPSpan(s *span) otlpSpan {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys := make([]string, 0, len(s.attributes))
+	for key := range s.attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attributes := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		attributes = append(attributes, otlpAttribute{Key: key, Value: otlpValue{StringValue: s.attributes[key]}})
+	}
+
+	status := otlpStatus{Code: otlpStatusOK}
+	if s.err != nil {
+		status = otlpStatus{Code: otlpStatusError, Message: s.err.Error()}
+	}
+
+	result := otlpSpan{
+		TraceID:           hex.EncodeToString(s.context.traceID[:]),
+		SpanID:            hex.EncodeToString(s.context.spanID[:]),
+		Name:              s.name,
+		Kind:              otlpSpanKindConsumer,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        attributes,
+		Status:            status,
+	}
+	if s.parent != (spanID{}) {
+		result.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	return result
+}
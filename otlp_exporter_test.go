@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOTLPExporterSendsSpansToCollector(t *testing.T) {
+	requests := make(chan otlpTraceRequest, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, otlpTracesPath, r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		request := otlpTraceRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests <- request
+	}))
+	defer collector.Close()
+
+	exporter := newOTLPExporter(collector.URL, "cms-kafka-bridge-pub-prod-eu", time.Hour)
+	tracer := newTracer(exporter, newFakeClock())
+
+	s := tracer.startSpan("forward NativeCmsPublicationEvents", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	s.setAttribute(tidAttribute, "tid_t9happe59y")
+	s.finish()
+	failed := tracer.startSpan("forward NativeCmsPublicationEvents", "")
+	failed.setError(errors.New("Status: 503"))
+	failed.finish()
+
+	exporter.stop()
+
+	select {
+	case request := <-requests:
+		assert.Len(t, request.ResourceSpans, 1)
+		assert.Equal(t, []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: "cms-kafka-bridge-pub-prod-eu"}}}, request.ResourceSpans[0].Resource.Attributes)
+
+		spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+		assert.Len(t, spans, 2)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", spans[0].ParentSpanID)
+		assert.Equal(t, otlpSpanKindConsumer, spans[0].Kind)
+		assert.Equal(t, "1436184000000000000", spans[0].StartTimeUnixNano)
+		assert.Equal(t, otlpStatus{Code: otlpStatusOK}, spans[0].Status)
+		assert.Equal(t, []otlpAttribute{{Key: tidAttribute, Value: otlpValue{StringValue: "tid_t9happe59y"}}}, spans[0].Attributes)
+		assert.Equal(t, otlpStatus{Code: otlpStatusError, Message: "Status: 503"}, spans[1].Status)
+	case <-time.After(time.Second):
+		t.Fatal("Spans were not exported on stop")
+	}
+}
+
+func TestOTLPExporterDropsSpansWhenQueueIsFull(t *testing.T) {
+	exporter := &otlpExporter{spans: make(chan *span, 1)}
+	exporter.export(&span{})
+	exporter.export(&span{})
+	assert.Len(t, exporter.spans, 1)
+}
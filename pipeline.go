@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+)
+
+// messageStage is a step of the pipeline a message goes through before it is forwarded. A stage can inspect and mutate
+// the message, drop it by returning a *stageDrop, or fail it by returning any other error.
+type messageStage interface {
+	process(message *queueProducer.Message) error
+}
+
+// stageDrop is returned by a stage which drops a message. Its outcome is recorded on the span of the forward; stages log
+// and count the messages they drop themselves.
+type stageDrop struct {
+	outcome string
+}
+
+func (d *stageDrop) Error() string {
+	return "Message dropped as " + d.outcome
+}
+
+// stageSettings is what the stages are built from.
+type stageSettings struct {
+	Stale     staleSettings
+	Transform transformSettings
+	Metrics   *metricsRegistry
+	DryRun    bool
+}
+
+type staleSettings struct {
+	MaxAge            time.Duration
+	ClockSkew         time.Duration
+	Action            string
+	DeadLetterAddress string
+	DeadLetterTopic   string
+	Authorization     string
+}
+
+// stageFactory describes a stage messages can go through. New returns a nil stage when the settings disable it.
+type stageFactory struct {
+	Name        string
+	Description string
+	New         func(settings stageSettings) (messageStage, error)
+}
+
+var stageFactories = map[string]stageFactory{}
+
+// registerStage makes a stage available through -stages. Stages register themselves in init.
+func registerStage(factory stageFactory) {
+	if _, found := stageFactories[factory.Name]; found {
+		panic(fmt.Sprintf("Stage %s is registered twice", factory.Name))
+	}
+	stageFactories[factory.Name] = factory
+}
+
+func stageNames() []string {
+	var names []string
+	for name := range stageFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// describeStages lists the registered stages with their description, for the usage of -stages.
+func describeStages() string {
+	var descriptions []string
+	for _, name := range stageNames() {
+		descriptions = append(descriptions, fmt.Sprintf("%s: %s", name, stageFactories[name].Description))
+	}
+	return strings.Join(descriptions, " ")
+}
+
+type namedStage struct {
+	name  string
+	stage messageStage
+}
+
+// pipeline runs the stages of a bridge in order. A nil pipeline has no stages.
+type pipeline struct {
+	stages []namedStage
+}
+
+// newPipeline builds the listed stages, which must start with the tid one so that every later stage and log has a TID.
+func newPipeline(names []string, settings stageSettings) (*pipeline, error) {
+	if len(names) == 0 || names[0] != tidStageName {
+		return nil, fmt.Errorf("The stages should start with %s, got '%s'", tidStageName, strings.Join(names, ","))
+	}
+	p := &pipeline{}
+	listed := map[string]bool{}
+	for _, name := range names {
+		factory, found := stageFactories[name]
+		if !found {
+			return nil, fmt.Errorf("Unknown stage '%s', it should be one of: %s", name, strings.Join(stageNames(), ", "))
+		}
+		if listed[name] {
+			return nil, fmt.Errorf("Stage %s is listed more than once", name)
+		}
+		listed[name] = true
+		stage, err := factory.New(settings)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid stage %s: %v", name, err.Error())
+		}
+		if stage != nil {
+			p.stages = append(p.stages, namedStage{name: name, stage: stage})
+		}
+	}
+	return p, nil
+}
+
+// process runs the message through the stages, stopping at the first one which drops or fails it.
+func (p *pipeline) process(message *queueProducer.Message) error {
+	if p == nil {
+		return nil
+	}
+	for _, s := range p.stages {
+		err := s.stage.process(message)
+		if _, dropped := err.(*stageDrop); dropped {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("Stage %s failed: %v", s.name, err.Error())
+		}
+	}
+	return nil
+}
+
+// names lists the stages messages go through, leaving out the ones disabled by their settings.
+func (p *pipeline) names() []string {
+	if p == nil {
+		return nil
+	}
+	var names []string
+	for _, s := range p.stages {
+		names = append(names, s.name)
+	}
+	return names
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/stretchr/testify/assert"
+)
+
+type funcStage func(message *queueProducer.Message) error
+
+func (f funcStage) process(message *queueProducer.Message) error {
+	return f(message)
+}
+
+func TestNewPipeline(t *testing.T) {
+	p, err := newPipeline([]string{"tid", "stale"}, stageSettings{Stale: staleSettings{MaxAge: time.Hour, Action: staleDrop}, Metrics: newMetricsRegistry()})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tid", "stale"}, p.names())
+
+	p, err = newPipeline([]string{"tid", "stale"}, stageSettings{Metrics: newMetricsRegistry()})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tid"}, p.names(), "The stale stage is disabled without -stale_max_age")
+}
+
+func TestNewPipelineInvalidStages(t *testing.T) {
+	var tests = []struct {
+		stages        []string
+		expectedError string
+	}{
+		{nil, "The stages should start with tid, got ''"},
+		{[]string{"stale", "tid"}, "The stages should start with tid, got 'stale,tid'"},
+		{[]string{"tid", "enrich"}, "Unknown stage 'enrich', it should be one of: stale, tid, transform"},
+		{[]string{"tid", "tid"}, "Stage tid is listed more than once"},
+		{[]string{"tid", "stale"}, "Invalid stage stale: Unknown stale action 'archive'. Possible values are: drop, deadletter, tag"},
+	}
+
+	for _, test := range tests {
+		_, err := newPipeline(test.stages, stageSettings{Stale: staleSettings{MaxAge: time.Hour, Action: "archive"}, Metrics: newMetricsRegistry()})
+		assert.EqualError(t, err, test.expectedError, strings.Join(test.stages, ","))
+	}
+}
+
+func TestTIDStage(t *testing.T) {
+	message := &queueProducer.Message{Headers: map[string]string{"X-Request-Id": "tid_t9happe59y"}}
+	assert.NoError(t, tidStage{}.process(message))
+	assert.Equal(t, "tid_t9happe59y", message.Headers["X-Request-Id"])
+
+	message = &queueProducer.Message{Headers: map[string]string{}}
+	assert.NoError(t, tidStage{}.process(message))
+	assert.Regexp(t, "^tid_[a-zA-Z0-9]{10}_kafka_bridge$", message.Headers["X-Request-Id"])
+}
+
+func TestPipelineRunsStagesInOrder(t *testing.T) {
+	var calls []string
+	stage := func(name string, err error) namedStage {
+		return namedStage{name: name, stage: funcStage(func(message *queueProducer.Message) error {
+			calls = append(calls, name)
+			message.Headers["X-Stages"] += name + ";"
+			return err
+		})}
+	}
+
+	var tests = []struct {
+		stages        []namedStage
+		expectedCalls []string
+		expectedError string
+	}{
+		{[]namedStage{stage("first", nil), stage("second", nil)}, []string{"first", "second"}, ""},
+		{[]namedStage{stage("first", &stageDrop{outcome: "filtered"}), stage("second", nil)}, []string{"first"}, "Message dropped as filtered"},
+		{[]namedStage{stage("first", nil), stage("second", errors.New("invalid body")), stage("third", nil)}, []string{"first", "second"}, "Stage second failed: invalid body"},
+	}
+
+	for _, test := range tests {
+		calls = nil
+		message := &queueProducer.Message{Headers: map[string]string{}}
+		err := (&pipeline{stages: test.stages}).process(message)
+		assert.Equal(t, test.expectedCalls, calls)
+		assert.Equal(t, strings.Join(test.expectedCalls, ";")+";", message.Headers["X-Stages"])
+		if test.expectedError == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, test.expectedError)
+		}
+	}
+}
+
+func TestForwardMsgThroughPipeline(t *testing.T) {
+	var tests = []struct {
+		stageErr          error
+		expectedForwarded int64
+		expectedFailed    int64
+		expectedHandled   bool
+	}{
+		{nil, 1, 0, true},
+		{&stageDrop{outcome: "filtered"}, 0, 0, true},
+		{errors.New("invalid body"), 0, 1, false},
+	}
+
+	for _, test := range tests {
+		destination := &stubDestination{}
+		stageErr := test.stageErr
+		bridge := BridgeApp{
+			producerInstance: destination,
+			metrics:          newMetricsRegistry(),
+			forwarding:       newForwardingMonitor(time.Minute, systemClock{}),
+			pipeline: &pipeline{stages: []namedStage{
+				{name: tidStageName, stage: tidStage{}},
+				{name: "enrich", stage: funcStage(func(message *queueProducer.Message) error {
+					message.Headers["X-Enriched"] = "true"
+					return stageErr
+				})},
+			}},
+		}
+
+		bridge.forwardMsg(consumedMessage{Message: queueConsumer.Message{Headers: map[string]string{}, Body: "{}"}})
+
+		assert.Equal(t, test.expectedForwarded, bridge.metrics.counter(forwardedMessagesMetric).Count())
+		assert.Equal(t, test.expectedFailed, bridge.metrics.counter(failedMessagesMetric).Count())
+		assert.Equal(t, test.expectedHandled, !bridge.forwarding.lastHandled.IsZero(), "Dropped messages count as handled, failed ones don't")
+		if test.expectedForwarded == 1 {
+			assert.Len(t, destination.messages, 1)
+			assert.Equal(t, "true", destination.messages[0].Headers["X-Enriched"])
+			assert.NotEmpty(t, destination.messages[0].Headers["X-Request-Id"])
+		} else {
+			assert.Empty(t, destination.messages)
+		}
+	}
+}
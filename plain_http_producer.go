@@ -19,10 +19,37 @@ type plainHTTPMessageProducer struct {
 	client plainHttpClient
 }
 
+// httpStatusError is returned when the destination responded with an unexpected status.
+type httpStatusError struct {
+	StatusCode int
+	message    string
+}
+
+func (e *httpStatusError) Error() string {
+	return e.message
+}
+
 type plainHttpClient interface {
 	Do(req *http.Request) (resp *http.Response, err error)
 }
 
+func init() {
+	registerProducer(producerFactory{
+		Name:        plainHTTP,
+		Description: "Posts every message to the /notify endpoint of -producer_address, e.g. cms-notifier.",
+		Settings: []producerSetting{
+			{Flag: "producer_address", Required: true},
+			{Flag: "producer_vulcan_auth"},
+		},
+		New: func(settings producerSettings) (queueProducer.MessageProducer, error) {
+			if err := requireAddress(plainHTTP, settings); err != nil {
+				return nil, err
+			}
+			return newPlainHTTPMessageProducer(settings.Config), nil
+		},
+	})
+}
+
 // newPlainHTTPMessageProducer returns a plain-http-producer which behaves as a producer for kafka (writes messages to kafka), but it's actually making a simple http call to an endpoint
 func newPlainHTTPMessageProducer(config queueProducer.MessageProducerConfig) queueProducer.MessageProducer {
 	cmsNotifier := &plainHTTPMessageProducer{config, &http.Client{
@@ -43,48 +70,74 @@ func (c *plainHTTPMessageProducer) SendMessage(uuid string, message queueProduce
 		return errors.New(errMsg)
 	}
 
-	req.Header.Add("X-Request-Id", message.Headers["X-Request-Id"])
+	req.Header = c.requestHeaders(uuid, message)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		errMsg := fmt.Sprintf("Error executing POST request to the ELB: %v", err.Error())
+		return errors.New(errMsg)
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		errMsg := fmt.Sprintf("Forwarding message with tid: %s is not successful. Status: %d", message.Headers["X-Request-Id"], resp.StatusCode)
+		return &httpStatusError{StatusCode: resp.StatusCode, message: errMsg}
+	}
+	return nil
+}
+
+// requestHeaders maps the headers of the message to the headers of the request posted to the destination.
+func (c *plainHTTPMessageProducer) requestHeaders(uuid string, message queueProducer.Message) http.Header {
+	header := http.Header{}
+	header.Add("X-Request-Id", message.Headers["X-Request-Id"])
 
 	originSystem, found := message.Headers["Origin-System-Id"]
 	if !found {
 		logger.NewEntry(message.Headers["X-Request-Id"]).WithUUID(uuid).Info("Couldn't extract origin system id. Going on.")
 	} else {
-		req.Header.Add("X-Origin-System-Id", originSystem)
+		header.Add("X-Origin-System-Id", originSystem)
 	}
 
 	timestamp := message.Headers["Message-Timestamp"]
 	if timestamp != "" {
-		req.Header.Add("Message-Timestamp", timestamp)
+		header.Add("Message-Timestamp", timestamp)
 	}
 	if len(c.config.Authorization) > 0 {
-		req.Header.Add("Authorization", c.config.Authorization)
+		header.Add("Authorization", c.config.Authorization)
 	}
 
 	nativeHash, found := message.Headers["Native-Hash"]
 	if found {
-		req.Header.Add("X-Native-Hash", nativeHash)
+		header.Add("X-Native-Hash", nativeHash)
 	}
 
-	contentType, found := message.Headers["Content-Type"]
+	stale, found := message.Headers[staleMessageHeader]
 	if found {
-		req.Header.Add("Content-Type", contentType)
+		header.Add(staleMessageHeader, stale)
 	}
 
-	resp, err := c.client.Do(req)
-	if err != nil {
-		errMsg := fmt.Sprintf("Error executing POST request to the ELB: %v", err.Error())
-		return errors.New(errMsg)
+	traceparent, found := message.Headers[traceparentHeader]
+	if found {
+		header.Add(traceparentHeader, traceparent)
 	}
-	defer func() {
-		io.Copy(ioutil.Discard, resp.Body)
-		resp.Body.Close()
-	}()
 
-	if resp.StatusCode != http.StatusOK {
-		errMsg := fmt.Sprintf("Forwarding message with tid: %s is not successful. Status: %d", message.Headers["X-Request-Id"], resp.StatusCode)
-		return errors.New(errMsg)
+	contentType, found := message.Headers["Content-Type"]
+	if found {
+		header.Add("Content-Type", contentType)
 	}
-	return nil
+	return header
+}
+
+// preview describes the request posted to the destination for the message.
+func (c *plainHTTPMessageProducer) preview(message queueProducer.Message) string {
+	headers := map[string]string{}
+	for key, values := range c.requestHeaders("", message) {
+		headers[key] = strings.Join(values, ", ")
+	}
+	return fmt.Sprintf("POST %s/notify with headers %s and a body of %d bytes", redactURL(c.config.Addr), formatHeaders(headers), len(message.Body))
 }
 
 func (c *plainHTTPMessageProducer) ConnectivityCheck() (string, error) {
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+)
+
+// producerSettings is what a producer is built from: the destination of the bridge and the options of the producer
+// types, by name, as returned by their Flags.
+type producerSettings struct {
+	Config  queueProducer.MessageProducerConfig
+	Options map[string]interface{}
+}
+
+// producerSetting documents a flag a producer type is configured with.
+type producerSetting struct {
+	Flag     string
+	Required bool
+}
+
+// requireAddress is the validation shared by the producer types which forward to -producer_address.
+func requireAddress(producerType string, settings producerSettings) error {
+	if settings.Config.Addr == "" {
+		return fmt.Errorf("Producer type %s requires -producer_address", producerType)
+	}
+	return nil
+}
+
+// stoppableProducer is implemented by the producers holding messages or goroutines in the background, which have to be
+// stopped once the consumer is, before the bridge exits.
+type stoppableProducer interface {
+	stop()
+}
+
+// stopProducer stops the producer if it needs to.
+func stopProducer(p queueProducer.MessageProducer) {
+	if s, ok := p.(stoppableProducer); ok {
+		s.stop()
+	}
+}
+
+// producerFactory describes a producer type the bridge can forward messages with. Flags declares the flags specific to
+// the producer type and returns the options they are parsed into; it is nil for the types without flags of their own.
+type producerFactory struct {
+	Name        string
+	Description string
+	Settings    []producerSetting
+	Flags       func(flags *flag.FlagSet) interface{}
+	New         func(settings producerSettings) (queueProducer.MessageProducer, error)
+}
+
+var producerFactories = map[string]producerFactory{}
+
+// registerProducer makes a producer type available through -producer_type. Producer types register themselves in init.
+func registerProducer(factory producerFactory) {
+	if _, found := producerFactories[factory.Name]; found {
+		panic(fmt.Sprintf("Producer type %s is registered twice", factory.Name))
+	}
+	producerFactories[factory.Name] = factory
+}
+
+// declareProducerFlags declares the flags of every producer type, as the destinations of a fanout or router producer can
+// be of any type, and returns the options of the producer types to build them with once the flags are parsed.
+func declareProducerFlags(flags *flag.FlagSet) map[string]interface{} {
+	options := map[string]interface{}{}
+	for _, name := range producerTypes() {
+		if factory := producerFactories[name]; factory.Flags != nil {
+			options[name] = factory.Flags(flags)
+		}
+	}
+	return options
+}
+
+// stringOption returns the option of a producer type declared as a single string flag, or an empty string if it isn't set.
+func stringOption(settings producerSettings, producerType string) string {
+	if value, ok := settings.Options[producerType].(*string); ok {
+		return *value
+	}
+	return ""
+}
+
+// newProducer builds a producer of the registered type.
+func newProducer(producerType string, settings producerSettings) (queueProducer.MessageProducer, error) {
+	factory, found := producerFactories[producerType]
+	if !found {
+		return nil, fmt.Errorf("Unknown producer type '%s', it should be one of: %s", producerType, strings.Join(producerTypes(), ", "))
+	}
+	return factory.New(settings)
+}
+
+func producerTypes() []string {
+	var names []string
+	for name := range producerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// describeProducerTypes lists the registered producer types with their description and settings, for the usage of -producer_type.
+func describeProducerTypes() string {
+	var descriptions []string
+	for _, name := range producerTypes() {
+		factory := producerFactories[name]
+		var flags []string
+		for _, setting := range factory.Settings {
+			flag := "-" + setting.Flag
+			if setting.Required {
+				flag += " (required)"
+			}
+			flags = append(flags, flag)
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s: %s Settings: %s.", name, factory.Description, strings.Join(flags, ", ")))
+	}
+	return strings.Join(descriptions, " ")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProducer(t *testing.T) {
+	config := queueProducer.MessageProducerConfig{Addr: "http://kafka-proxy:8080", Topic: "NativeCmsPublicationEvents"}
+
+	p, err := newProducer(plainHTTP, producerSettings{Config: config})
+	assert.NoError(t, err)
+	assert.IsType(t, &plainHTTPMessageProducer{}, p)
+
+	p, err = newProducer(proxy, producerSettings{Config: config, Options: parseProducerFlags(t, "-producer_batch_max_messages=10")})
+	assert.NoError(t, err)
+	assert.IsType(t, &batchingProxyProducer{}, p)
+
+	p, err = newProducer(proxy, producerSettings{Config: config, Options: parseProducerFlags(t)})
+	assert.NoError(t, err)
+	assert.NotNil(t, p)
+	_, batching := p.(*batchingProxyProducer)
+	assert.False(t, batching, "Batching is disabled by default")
+}
+
+func TestDeclareProducerFlags(t *testing.T) {
+	options := parseProducerFlags(t, "-producer_batch_max_messages=10", "-producer_batch_linger=1s", "-producer_routes={}")
+
+	assert.Equal(t, &proxyBatchConfig{MaxMessages: 10, MaxBytes: 1024 * 1024, Linger: time.Second, MaxInFlight: 4}, options[proxy])
+	assert.Equal(t, "{}", stringOption(producerSettings{Options: options}, router))
+	assert.Equal(t, "", stringOption(producerSettings{Options: options}, fanout))
+	assert.Equal(t, "", stringOption(producerSettings{}, router))
+	assert.NotContains(t, options, plainHTTP, "plainHTTP has no flags of its own")
+}
+
+// parseProducerFlags returns the options of the producer types parsed from the arguments.
+func parseProducerFlags(t *testing.T, args ...string) map[string]interface{} {
+	flags := flag.NewFlagSet("kafka-bridge", flag.ContinueOnError)
+	options := declareProducerFlags(flags)
+	assert.NoError(t, flags.Parse(args))
+	return options
+}
+
+func TestNewProducerUnknownType(t *testing.T) {
+	_, err := newProducer("kafka", producerSettings{})
+	assert.EqualError(t, err, "Unknown producer type 'kafka', it should be one of: fanout, plainHTTP, proxy, router")
+}
+
+func TestNewProducerValidatesSettings(t *testing.T) {
+	var tests = []struct {
+		producerType  string
+		config        queueProducer.MessageProducerConfig
+		expectedError string
+	}{
+		{plainHTTP, queueProducer.MessageProducerConfig{}, "Producer type plainHTTP requires -producer_address"},
+		{proxy, queueProducer.MessageProducerConfig{Topic: "NativeCmsPublicationEvents"}, "Producer type proxy requires -producer_address"},
+		{proxy, queueProducer.MessageProducerConfig{Addr: "http://kafka-proxy:8080"}, "Producer type proxy requires -topic"},
+	}
+
+	for _, test := range tests {
+		_, err := newProducer(test.producerType, producerSettings{Config: test.config})
+		assert.EqualError(t, err, test.expectedError)
+	}
+}
+
+func TestRegisterProducer(t *testing.T) {
+	registerProducer(producerFactory{
+		Name:        "file",
+		Description: "Appends every message to a file.",
+		Settings:    []producerSetting{{Flag: "producer_address", Required: true}},
+		New: func(settings producerSettings) (queueProducer.MessageProducer, error) {
+			return &recordingProducer{}, nil
+		},
+	})
+	defer delete(producerFactories, "file")
+
+	p, err := newProducer("file", producerSettings{})
+	assert.NoError(t, err)
+	assert.IsType(t, &recordingProducer{}, p)
+	assert.True(t, strings.Contains(describeProducerTypes(), "file: Appends every message to a file. Settings: -producer_address (required)."))
+
+	assert.Panics(t, func() {
+		registerProducer(producerFactory{Name: "file"})
+	}, "A producer type can't be registered twice")
+}
+
+type stoppingProducer struct {
+	mockProducerInstance
+	stopped bool
+}
+
+func (p *stoppingProducer) stop() {
+	p.stopped = true
+}
+
+func TestStopProducerStopsDestinations(t *testing.T) {
+	eu, us, shadow := &stoppingProducer{}, &stoppingProducer{}, &stoppingProducer{}
+	fanout := &fanoutProducer{policy: fanoutAll, destinations: []bridgeDestination{{name: "eu", producer: eu}, {name: "us", producer: us}}}
+
+	stopProducer(newShadowProducer(fanout, bridgeDestination{name: "shadow", producer: shadow}, newMetricsRegistry()))
+	assert.True(t, eu.stopped)
+	assert.True(t, us.stopped)
+	assert.True(t, shadow.stopped)
+
+	stopProducer(&mockProducerInstance{})
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Financial-Times/go-logger"
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+)
+
+const router = "router"
+
+// errMessageDropped is returned by producers which deliberately didn't forward a message.
+var errMessageDropped = errors.New("Message was dropped")
+
+// routerConfig is the JSON of -producer_routes. Messages are routed by the value of a header or, when field is set,
+// of a field of the JSON body, e.g. "type" or "payload.type".
+type routerConfig struct {
+	Header  string        `json:"header"`
+	Field   string        `json:"field"`
+	Routes  []routeConfig `json:"routes"`
+	Default *routeConfig  `json:"default"`
+}
+
+// routeConfig sends the messages with one of the values to the destination, or drops them.
+type routeConfig struct {
+	Values      []string           `json:"values"`
+	Drop        bool               `json:"drop"`
+	Destination *destinationConfig `json:"destination"`
+}
+
+type route struct {
+	name        string
+	drop        bool
+	destination bridgeDestination
+}
+
+// routerProducer forwards every message to the destination of the route matching it, or to the default route.
+type routerProducer struct {
+	header       string
+	field        string
+	routes       map[string]*route
+	defaultRoute *route
+	destinations []bridgeDestination
+}
+
+func init() {
+	registerProducer(producerFactory{
+		Name:        router,
+		Description: "Forwards every message to the destination of -producer_routes matching a header or a field of the JSON body, or drops it.",
+		Settings: []producerSetting{
+			{Flag: "producer_routes", Required: true},
+			{Flag: "topic"},
+			{Flag: "producer_vulcan_auth"},
+		},
+		Flags: func(flags *flag.FlagSet) interface{} {
+			return flags.String("producer_routes", "", `JSON of the routes of the router producer type, e.g. {"header":"Origin-System-Id","routes":[{"values":["http://cmdb.ft.com/systems/methode-web-pub"],"destination":{"type":"plainHTTP","address":"http://cms-notifier:8080"}}],"default":{"drop":true}}. Routing by a field of the JSON body unmarshals the whole body of every message.`)
+		},
+		New: newRouterProducer,
+	})
+}
+
+func newRouterProducer(settings producerSettings) (queueProducer.MessageProducer, error) {
+	routes := stringOption(settings, router)
+	if routes == "" {
+		return nil, errors.New("Producer type router requires -producer_routes")
+	}
+	config := routerConfig{}
+	if err := json.Unmarshal([]byte(routes), &config); err != nil {
+		return nil, fmt.Errorf("Couldn't parse -producer_routes: %v", err.Error())
+	}
+	if (config.Header == "") == (config.Field == "") {
+		return nil, errors.New("-producer_routes should route by either a header or a field")
+	}
+	if config.Default == nil {
+		return nil, errors.New("-producer_routes has no default route, use {\"drop\":true} to drop the messages no route matches")
+	}
+
+	p := &routerProducer{header: config.Header, field: config.Field, routes: map[string]*route{}}
+	for i, routeConfig := range config.Routes {
+		if len(routeConfig.Values) == 0 {
+			return nil, fmt.Errorf("Route %d has no values", i+1)
+		}
+		r, err := p.newRoute(fmt.Sprintf("route-%d", i+1), routeConfig, settings)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range routeConfig.Values {
+			if _, found := p.routes[value]; found {
+				return nil, fmt.Errorf("Value '%s' is routed twice", value)
+			}
+			p.routes[value] = r
+		}
+	}
+	defaultRoute, err := p.newRoute("default", *config.Default, settings)
+	if err != nil {
+		return nil, err
+	}
+	p.defaultRoute = defaultRoute
+	return p, nil
+}
+
+func (p *routerProducer) newRoute(name string, config routeConfig, settings producerSettings) (*route, error) {
+	if config.Drop {
+		if config.Destination != nil {
+			return nil, fmt.Errorf("Route %s can't both drop messages and have a destination", name)
+		}
+		return &route{name: name, drop: true}, nil
+	}
+	if config.Destination == nil {
+		return nil, fmt.Errorf("Route %s needs a destination or \"drop\":true", name)
+	}
+	if config.Destination.Name == "" {
+		config.Destination.Name = name
+	}
+	destination, err := newDestination(*config.Destination, settings)
+	if err != nil {
+		return nil, err
+	}
+	p.destinations = append(p.destinations, destination)
+	return &route{name: destination.name, destination: destination}, nil
+}
+
+func (p *routerProducer) SendMessage(uuid string, message queueProducer.Message) error {
+	r, value := p.selectRoute(message)
+	if r.drop {
+		logger.NewEntry(message.Headers["X-Request-Id"]).WithUUID(uuid).Infof("Message dropped by route %s for '%s'", r.name, value)
+		return errMessageDropped
+	}
+	if err := r.destination.producer.SendMessage(uuid, message); err != nil {
+		return fmt.Errorf("Forwarding to %s failed: %v", r.name, err.Error())
+	}
+	return nil
+}
+
+// selectRoute returns the route of the message, falling back on the default one, and the routing value it was selected by.
+func (p *routerProducer) selectRoute(message queueProducer.Message) (*route, string) {
+	value := p.routingValue(message)
+	r, found := p.routes[value]
+	if !found {
+		r = p.defaultRoute
+	}
+	return r, value
+}
+
+// preview describes the route of the message and what its destination would be sent.
+func (p *routerProducer) preview(message queueProducer.Message) string {
+	r, value := p.selectRoute(message)
+	if r.drop {
+		return fmt.Sprintf("nothing, dropped by route %s for '%s'", r.name, value)
+	}
+	return fmt.Sprintf("%s to route %s for '%s'", previewMessage(r.destination.producer, message), r.name, value)
+}
+
+// routingValue returns the value of the routing header or body field, or an empty string when the message doesn't have it.
+func (p *routerProducer) routingValue(message queueProducer.Message) string {
+	if p.header != "" {
+		return message.Headers[p.header]
+	}
+
+	var body interface{}
+	if err := json.Unmarshal([]byte(message.Body), &body); err != nil {
+		return ""
+	}
+	for _, key := range strings.Split(p.field, ".") {
+		object, ok := body.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		body = object[key]
+	}
+	switch value := body.(type) {
+	case string:
+		return value
+	case nil, map[string]interface{}, []interface{}:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func (p *routerProducer) stop() {
+	for _, destination := range p.destinations {
+		stopProducer(destination.producer)
+	}
+}
+
+// ConnectivityCheck fails when any of the destinations can't be reached.
+func (p *routerProducer) ConnectivityCheck() (string, error) {
+	errs := make([]string, len(p.destinations))
+	var wg sync.WaitGroup
+	for i, destination := range p.destinations {
+		wg.Add(1)
+		go func(i int, destination bridgeDestination) {
+			defer wg.Done()
+			if _, err := destination.producer.ConnectivityCheck(); err != nil {
+				errs[i] = fmt.Sprintf("%s: %s", destination.name, err.Error())
+			}
+		}(i, destination)
+	}
+	wg.Wait()
+
+	var failures []string
+	for _, err := range errs {
+		if err != "" {
+			failures = append(failures, err)
+		}
+	}
+	if len(failures) > 0 {
+		return "Forwarding messages is broken.", errors.New(strings.Join(failures, "; "))
+	}
+	return fmt.Sprintf("All %d route destinations are reachable.", len(p.destinations)), nil
+}
+
+// describe lists the route destinations in the status of the bridge.
+func (p *routerProducer) describe(status *destinationStatus) {
+	for _, destination := range p.destinations {
+		status.Destinations = append(status.Destinations, destination.status())
+	}
+}
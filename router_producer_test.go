@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRouter(header string, field string) (*routerProducer, *stubDestination, *stubDestination) {
+	content := &stubDestination{}
+	metadata := &stubDestination{}
+	contentRoute := &route{name: "content", destination: bridgeDestination{name: "content", producer: content}}
+	metadataRoute := &route{name: "metadata", destination: bridgeDestination{name: "metadata", producer: metadata}}
+	return &routerProducer{
+		header: header,
+		field:  field,
+		routes: map[string]*route{
+			"cms-content-published": contentRoute,
+			"concept-annotation":    metadataRoute,
+			"2":                     metadataRoute,
+		},
+		defaultRoute: &route{name: "default", drop: true},
+		destinations: []bridgeDestination{contentRoute.destination, metadataRoute.destination},
+	}, content, metadata
+}
+
+func TestRouterRoutesByHeader(t *testing.T) {
+	p, content, metadata := newTestRouter("Message-Type", "")
+
+	assert.NoError(t, p.SendMessage("", queueProducer.Message{Headers: map[string]string{"Message-Type": "cms-content-published"}, Body: "{}"}))
+	assert.NoError(t, p.SendMessage("", queueProducer.Message{Headers: map[string]string{"Message-Type": "concept-annotation"}, Body: "{}"}))
+	assert.Equal(t, errMessageDropped, p.SendMessage("", queueProducer.Message{Headers: map[string]string{"Message-Type": "unknown"}, Body: "{}"}))
+	assert.Equal(t, errMessageDropped, p.SendMessage("", queueProducer.Message{Headers: map[string]string{}, Body: "{}"}))
+
+	assert.Len(t, content.messages, 1)
+	assert.Len(t, metadata.messages, 1)
+}
+
+func TestRouterRoutesByBodyField(t *testing.T) {
+	var tests = []struct {
+		field            string
+		body             string
+		expectedContent  int
+		expectedMetadata int
+	}{
+		{"type", `{"type":"cms-content-published"}`, 1, 0},
+		{"payload.type", `{"payload":{"type":"concept-annotation"}}`, 0, 1},
+		{"payload.version", `{"payload":{"version":2}}`, 0, 1},
+		{"payload.type", `{"payload":"concept-annotation"}`, 0, 0},
+		{"type", `not json`, 0, 0},
+	}
+
+	for _, test := range tests {
+		p, content, metadata := newTestRouter("", test.field)
+		p.SendMessage("", queueProducer.Message{Headers: map[string]string{}, Body: test.body})
+		assert.Len(t, content.messages, test.expectedContent, test.body)
+		assert.Len(t, metadata.messages, test.expectedMetadata, test.body)
+	}
+}
+
+func TestRouterReportsFailingRoute(t *testing.T) {
+	p, content, _ := newTestRouter("Message-Type", "")
+	content.err = errors.New("Status: 503")
+
+	err := p.SendMessage("", queueProducer.Message{Headers: map[string]string{"Message-Type": "cms-content-published"}, Body: "{}"})
+	assert.EqualError(t, err, "Forwarding to content failed: Status: 503")
+
+	_, err = p.ConnectivityCheck()
+	assert.EqualError(t, err, "content: Status: 503")
+}
+
+func TestNewRouterProducer(t *testing.T) {
+	p, err := newProducer(router, producerSettings{
+		Config: queueProducer.MessageProducerConfig{Topic: "NativeCmsPublicationEvents"},
+		Options: parseProducerFlags(t, `-producer_routes={"header":"Origin-System-Id","routes":[
+			{"values":["http://cmdb.ft.com/systems/methode-web-pub"],"destination":{"name":"cms-notifier","type":"plainHTTP","address":"http://cms-notifier:8080"}},
+			{"values":["http://cmdb.ft.com/systems/pac"],"destination":{"type":"plainHTTP","address":"http://cms-metadata-notifier:8080"}}],
+			"default":{"drop":true}}`),
+	})
+	assert.NoError(t, err)
+
+	r := p.(*routerProducer)
+	assert.Equal(t, "cms-notifier", r.routes["http://cmdb.ft.com/systems/methode-web-pub"].name)
+	assert.Equal(t, "route-2", r.routes["http://cmdb.ft.com/systems/pac"].name)
+	assert.True(t, r.defaultRoute.drop)
+	assert.Len(t, r.destinations, 2)
+}
+
+func TestNewRouterProducerInvalidConfig(t *testing.T) {
+	var tests = []struct {
+		routes        string
+		expectedError string
+	}{
+		{"", "Producer type router requires -producer_routes"},
+		{`{"default":{"drop":true}}`, "-producer_routes should route by either a header or a field"},
+		{`{"header":"Message-Type","field":"type","default":{"drop":true}}`, "-producer_routes should route by either a header or a field"},
+		{`{"header":"Message-Type"}`, `-producer_routes has no default route, use {"drop":true} to drop the messages no route matches`},
+		{`{"header":"Message-Type","routes":[{"drop":true}],"default":{"drop":true}}`, "Route 1 has no values"},
+		{`{"header":"Message-Type","routes":[{"values":["a"],"drop":true},{"values":["a"],"drop":true}],"default":{"drop":true}}`, "Value 'a' is routed twice"},
+		{`{"header":"Message-Type","default":{}}`, `Route default needs a destination or "drop":true`},
+		{`{"header":"Message-Type","default":{"drop":true,"destination":{"type":"plainHTTP","address":"http://cms-notifier:8080"}}}`, "Route default can't both drop messages and have a destination"},
+		{`{"header":"Message-Type","default":{"destination":{"type":"router"}}}`, "Destination default can't be a router itself"},
+	}
+
+	for _, test := range tests {
+		_, err := newProducer(router, producerSettings{Options: parseProducerFlags(t, "-producer_routes="+test.routes)})
+		assert.EqualError(t, err, test.expectedError, test.routes)
+	}
+}
+
+func TestForwardMsgCountsDroppedMessages(t *testing.T) {
+	p, _, _ := newTestRouter("Message-Type", "")
+	bridge := BridgeApp{producerInstance: p, producerType: router, metrics: newMetricsRegistry(), forwarding: newForwardingMonitor(time.Minute, systemClock{})}
+
+	bridge.observeConsumed(queueConsumer.Message{})
+	bridge.forwardMsg(consumedMessage{Message: queueConsumer.Message{Headers: map[string]string{"X-Request-Id": "tid_t9happe59y", "Message-Type": "unknown"}, Body: "{}"}})
+
+	assert.Equal(t, int64(1), bridge.metrics.counter(droppedMessagesMetric).Count())
+	assert.Equal(t, int64(0), bridge.metrics.counter(forwardedMessagesMetric).Count())
+	assert.Equal(t, int64(0), bridge.metrics.counter(failedMessagesMetric).Count())
+	assert.False(t, bridge.forwarding.lastHandled.IsZero(), "A message the router drops is handled for the last forward healthcheck")
+	_, err := bridge.forwarding.check()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+)
+
+const (
+	shadowQueueSize = 100
+	shadowWorkers   = 4
+)
+
+// Metrics of the shadow destination.
+const (
+	forwardLatencyMetric         = "forward_latency"
+	shadowLatencyMetric          = "shadow_forward_latency"
+	shadowForwardsMetric         = "shadow_forwards"
+	shadowStatusMismatchesMetric = "shadow_status_mismatches"
+	shadowDroppedMetric          = "shadow_dropped"
+)
+
+// shadowProducer forwards every message to the primary producer, and a copy of it to the shadow producer in the background.
+// The shadow never affects the outcome of a forward: its results are only compared with the primary ones.
+// Messages the primary producer deliberately drops aren't copied.
+type shadowProducer struct {
+	primary   queueProducer.MessageProducer
+	shadow    bridgeDestination
+	metrics   *metricsRegistry
+	queue     chan shadowForward
+	mutex     sync.Mutex
+	last      string
+	clock     clock
+	stopMutex sync.RWMutex
+	stopped   bool
+	stopping  chan struct{}
+	workers   sync.WaitGroup
+}
+
+type shadowForward struct {
+	uuid          string
+	message       queueProducer.Message
+	primaryStatus int
+	primaryTime   time.Duration
+}
+
+// shadowStatus summarises the comparison between the primary and the shadow destination.
+type shadowStatus struct {
+	Destination      destinationStatus `json:"destination"`
+	Forwards         int64             `json:"forwards"`
+	StatusMismatches int64             `json:"statusMismatches"`
+	Dropped          int64             `json:"dropped"`
+	PrimaryLatency   histogramSnapshot `json:"primaryLatency"`
+	ShadowLatency    histogramSnapshot `json:"shadowLatency"`
+	LastMismatch     string            `json:"lastMismatch,omitempty"`
+}
+
+func newShadowProducer(primary queueProducer.MessageProducer, shadow bridgeDestination, metrics *metricsRegistry) *shadowProducer {
+	p := &shadowProducer{
+		primary:  primary,
+		shadow:   shadow,
+		metrics:  metrics,
+		queue:    make(chan shadowForward, shadowQueueSize),
+		clock:    systemClock{},
+		stopping: make(chan struct{}),
+	}
+	p.workers.Add(shadowWorkers)
+	for i := 0; i < shadowWorkers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// newShadowDestination builds the shadow destination. It only shares the topic of the primary destination: the shadow is
+// usually another service, so the credentials of the primary are never sent to it, only the ones of -shadow_auth.
+func newShadowDestination(shadowType string, address string, authorization string, primary queueProducer.MessageProducerConfig, options map[string]interface{}) (bridgeDestination, error) {
+	return newDestination(destinationConfig{Name: "shadow", Type: shadowType, Address: address, Authorization: authorization}, producerSettings{
+		Config:  queueProducer.MessageProducerConfig{Topic: primary.Topic},
+		Options: options,
+	})
+}
+
+func (p *shadowProducer) SendMessage(uuid string, message queueProducer.Message) error {
+	start := p.clock.now()
+	err := p.primary.SendMessage(uuid, message)
+	if err == errMessageDropped {
+		return err
+	}
+	elapsed := p.clock.now().Sub(start)
+	p.metrics.histogram(forwardLatencyMetric).Observe(elapsed)
+
+	headers := make(map[string]string, len(message.Headers))
+	for key, value := range message.Headers {
+		headers[key] = value
+	}
+	forward := shadowForward{
+		uuid:          uuid,
+		message:       queueProducer.Message{Headers: headers, Body: message.Body},
+		primaryStatus: forwardStatus(err),
+		primaryTime:   elapsed,
+	}
+	p.enqueue(forward)
+	return err
+}
+
+// enqueue queues the copy for the shadow workers, or counts it as dropped when the queue is full or the producer stopped.
+func (p *shadowProducer) enqueue(forward shadowForward) {
+	p.stopMutex.RLock()
+	defer p.stopMutex.RUnlock()
+	if p.stopped {
+		p.metrics.counter(shadowDroppedMetric).Inc()
+		return
+	}
+	select {
+	case p.queue <- forward:
+	default:
+		p.metrics.counter(shadowDroppedMetric).Inc()
+	}
+}
+
+// preview describes what the primary and the shadow destination would be sent.
+func (p *shadowProducer) preview(message queueProducer.Message) string {
+	return fmt.Sprintf("%s, with a copy as %s to the shadow destination", previewMessage(p.primary, message), previewMessage(p.shadow.producer, message))
+}
+
+// ConnectivityCheck only checks the primary destination, as the shadow doesn't affect forwarding.
+func (p *shadowProducer) ConnectivityCheck() (string, error) {
+	return p.primary.ConnectivityCheck()
+}
+
+// stop waits for the copies being sent to the shadow destination, counts the queued ones as dropped, and stops both
+// producers.
+func (p *shadowProducer) stop() {
+	p.stopMutex.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.stopping)
+		close(p.queue)
+	}
+	p.stopMutex.Unlock()
+	p.workers.Wait()
+
+	stopProducer(p.primary)
+	stopProducer(p.shadow.producer)
+}
+
+func (p *shadowProducer) work() {
+	defer p.workers.Done()
+	for forward := range p.queue {
+		select {
+		case <-p.stopping:
+			p.metrics.counter(shadowDroppedMetric).Inc()
+		default:
+			p.compare(forward)
+		}
+	}
+}
+
+func (p *shadowProducer) compare(forward shadowForward) {
+	// counted last, so that a counted forward is fully recorded
+	defer p.metrics.counter(shadowForwardsMetric).Inc()
+
+	start := p.clock.now()
+	err := p.shadow.producer.SendMessage(forward.uuid, forward.message)
+	elapsed := p.clock.now().Sub(start)
+	p.metrics.histogram(shadowLatencyMetric).Observe(elapsed)
+
+	status := forwardStatus(err)
+	if status == forward.primaryStatus {
+		return
+	}
+	p.metrics.counter(shadowStatusMismatchesMetric).Inc()
+	tid := forward.message.Headers["X-Request-Id"]
+	mismatch := fmt.Sprintf("%s %s: primary status %d in %v, shadow %s status %d in %v", formatTime(p.clock.now()), tid,
+		forward.primaryStatus, forward.primaryTime.Truncate(time.Millisecond), p.shadow.name, status, elapsed.Truncate(time.Millisecond))
+	if err != nil {
+		mismatch += ": " + err.Error()
+	}
+	logger.NewEntry(tid).WithUUID(forward.uuid).Info("Shadow destination responded differently: " + mismatch)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.last = mismatch
+}
+
+func (p *shadowProducer) status() *shadowStatus {
+	p.mutex.Lock()
+	last := p.last
+	p.mutex.Unlock()
+	return &shadowStatus{
+		Destination:      p.shadow.status(),
+		Forwards:         p.metrics.counter(shadowForwardsMetric).Count(),
+		StatusMismatches: p.metrics.counter(shadowStatusMismatchesMetric).Count(),
+		Dropped:          p.metrics.counter(shadowDroppedMetric).Count(),
+		PrimaryLatency:   p.metrics.histogram(forwardLatencyMetric).Snapshot(),
+		ShadowLatency:    p.metrics.histogram(shadowLatencyMetric).Snapshot(),
+		LastMismatch:     last,
+	}
+}
+
+// forwardStatus is the HTTP status of a forward: 200 when it succeeded, the status the destination responded with,
+// or 0 when the destination couldn't be reached or the producer doesn't report statuses.
+func forwardStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if statusErr, ok := err.(*httpStatusError); ok {
+		return statusErr.StatusCode
+	}
+	return 0
+}
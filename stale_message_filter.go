@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
+)
+
+const (
+	staleDrop       = "drop"
+	staleDeadLetter = "deadletter"
+	staleTag        = "tag"
+
+	staleMessageHeader = "X-Stale-Message"
+)
+
+// staleMessageFilter decides what happens to messages whose Message-Timestamp is older than the configured maximum age.
+type staleMessageFilter struct {
+	maxAge     time.Duration
+	clockSkew  time.Duration
+	action     string
+	deadLetter queueProducer.MessageProducer
+	dryRun     bool
+	ages       *histogram
+	stale      *counter
+	clock      clock
+}
+
+func init() {
+	registerStage(stageFactory{
+		Name:        "stale",
+		Description: "Drops, dead-letters or tags the messages older than -stale_max_age, as set by -stale_action. It does nothing when -stale_max_age isn't set.",
+		New: func(settings stageSettings) (messageStage, error) {
+			stale := settings.Stale
+			if stale.MaxAge <= 0 {
+				return nil, nil
+			}
+			if stale.Action == staleDeadLetter && (stale.DeadLetterAddress == "" || stale.DeadLetterTopic == "") {
+				return nil, fmt.Errorf("-stale_action=%s requires -stale_dead_letter_address and -stale_dead_letter_topic", staleDeadLetter)
+			}
+			var deadLetter queueProducer.MessageProducer
+			if stale.Action == staleDeadLetter {
+				deadLetter = queueProducer.NewMessageProducer(queueProducer.MessageProducerConfig{
+					Addr:          stale.DeadLetterAddress,
+					Topic:         stale.DeadLetterTopic,
+					Authorization: stale.Authorization,
+				})
+			}
+			filter, err := newStaleMessageFilter(stale.MaxAge, stale.ClockSkew, stale.Action, deadLetter, settings.Metrics, systemClock{})
+			if err != nil {
+				return nil, err
+			}
+			filter.dryRun = settings.DryRun
+			return filter, nil
+		},
+	})
+}
+
+func newStaleMessageFilter(maxAge time.Duration, clockSkew time.Duration, action string, deadLetter queueProducer.MessageProducer, metrics *metricsRegistry, clock clock) (*staleMessageFilter, error) {
+	switch action {
+	case staleDrop, staleTag:
+	case staleDeadLetter:
+		if deadLetter == nil {
+			return nil, fmt.Errorf("Stale action '%s' requires a dead letter producer", action)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown stale action '%s'. Possible values are: %s, %s, %s", action, staleDrop, staleDeadLetter, staleTag)
+	}
+
+	return &staleMessageFilter{
+		maxAge:     maxAge,
+		clockSkew:  clockSkew,
+		action:     action,
+		deadLetter: deadLetter,
+		ages:       metrics.histogram(messageAgeMetric),
+		stale:      metrics.counter(staleMessagesMetric),
+		clock:      clock,
+	}, nil
+}
+
+// process drops the message when it is stale and isn't forwarded tagged. It fails the message when it couldn't be sent
+// to the dead letter topic, so that it isn't lost silently.
+func (f *staleMessageFilter) process(message *queueProducer.Message) error {
+	accepted, err := f.accept(message.Headers["X-Request-Id"], queueConsumer.Message{Headers: message.Headers, Body: message.Body})
+	if err != nil {
+		return err
+	}
+	if !accepted {
+		return &stageDrop{outcome: "stale"}
+	}
+	return nil
+}
+
+// accept records the age of the message and reports whether it should still be forwarded.
+// Messages without a valid Message-Timestamp are always accepted.
+func (f *staleMessageFilter) accept(tid string, msg queueConsumer.Message) (bool, error) {
+	timestamp, err := extractTimestamp(msg.Headers)
+	if err != nil {
+		return true, nil
+	}
+
+	age := f.clock.now().Sub(timestamp)
+	if age < -f.clockSkew {
+		logger.NewEntry(tid).Info(fmt.Sprintf("Message-Timestamp is %v in the future, beyond the tolerated clock skew.", -age))
+	}
+	if age < 0 {
+		age = 0
+	}
+	f.ages.Observe(age)
+
+	if age <= f.maxAge+f.clockSkew {
+		return true, nil
+	}
+	f.stale.Inc()
+
+	switch f.action {
+	case staleTag:
+		msg.Headers[staleMessageHeader] = "true"
+		logger.NewEntry(tid).Info(fmt.Sprintf("Message is %v old. It will be forwarded tagged as stale.", age))
+		return true, nil
+	case staleDeadLetter:
+		if f.dryRun {
+			logger.NewEntry(tid).Info(fmt.Sprintf("Message is %v old. Dry run, it would have been sent to the dead letter topic instead of being forwarded.", age))
+			return false, nil
+		}
+		if err := f.deadLetter.SendMessage("", queueProducer.Message{Headers: msg.Headers, Body: msg.Body}); err != nil {
+			return false, fmt.Errorf("Message is %v old and couldn't be sent to the dead letter topic: %v", age, err.Error())
+		}
+		logger.NewEntry(tid).Info(fmt.Sprintf("Message is %v old. It was sent to the dead letter topic instead of being forwarded.", age))
+		return false, nil
+	default:
+		logger.NewEntry(tid).Info(fmt.Sprintf("Message is %v old. It was dropped.", age))
+		return false, nil
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingProducer struct {
+	mockProducerInstance
+	messages []queueProducer.Message
+}
+
+func (p *recordingProducer) SendMessage(uuid string, message queueProducer.Message) error {
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+func newTestStaleFilter(t *testing.T, action string, deadLetter queueProducer.MessageProducer) *staleMessageFilter {
+	filter, err := newStaleMessageFilter(time.Hour, time.Minute, action, deadLetter, newMetricsRegistry(), newFakeClock())
+	assert.NoError(t, err)
+	return filter
+}
+
+func staleTestMessage(timestamp string) queueConsumer.Message {
+	return queueConsumer.Message{
+		Headers: map[string]string{"X-Request-Id": "tid_t9happe59y", "Message-Timestamp": timestamp},
+		Body:    `{"uuid":"7543220a-2389-11e5-bd83-71cb60e8f08c"}`,
+	}
+}
+
+func TestStaleFilterAcceptsFreshMessages(t *testing.T) {
+	filter := newTestStaleFilter(t, staleDrop, nil)
+
+	var tests = []string{
+		"2015-07-06T11:30:00.000Z", // half an hour old
+		"2015-07-06T10:59:30.000Z", // over the maximum age, but within the clock skew
+		"2015-07-06T12:30:00.000Z", // in the future
+		"",                         // no timestamp
+		"invalid",
+	}
+	for _, timestamp := range tests {
+		accepted, err := filter.accept("tid_t9happe59y", staleTestMessage(timestamp))
+		assert.NoError(t, err)
+		assert.True(t, accepted, "Message with timestamp '%s' should be accepted", timestamp)
+	}
+	assert.Equal(t, int64(0), filter.stale.Count())
+	assert.Equal(t, int64(3), filter.ages.Snapshot().Count)
+	assert.Equal(t, float64(0), filter.ages.Snapshot().Min, "Ages in the future should be recorded as 0")
+}
+
+func TestStaleFilterDrops(t *testing.T) {
+	filter := newTestStaleFilter(t, staleDrop, nil)
+
+	accepted, err := filter.accept("tid_t9happe59y", staleTestMessage("2015-07-06T10:00:00.000Z"))
+	assert.NoError(t, err)
+	assert.False(t, accepted)
+	assert.Equal(t, int64(1), filter.stale.Count())
+}
+
+func TestStaleFilterTags(t *testing.T) {
+	filter := newTestStaleFilter(t, staleTag, nil)
+	msg := staleTestMessage("2015-07-06T10:00:00.000Z")
+
+	accepted, err := filter.accept("tid_t9happe59y", msg)
+	assert.NoError(t, err)
+	assert.True(t, accepted)
+	assert.Equal(t, "true", msg.Headers[staleMessageHeader])
+}
+
+func TestStaleFilterDeadLetters(t *testing.T) {
+	deadLetter := &recordingProducer{}
+	filter := newTestStaleFilter(t, staleDeadLetter, deadLetter)
+	msg := staleTestMessage("2015-07-06T10:00:00.000Z")
+
+	accepted, err := filter.accept("tid_t9happe59y", msg)
+	assert.NoError(t, err)
+	assert.False(t, accepted)
+	assert.Len(t, deadLetter.messages, 1)
+	assert.Equal(t, msg.Body, deadLetter.messages[0].Body)
+}
+
+func TestStaleFilterFailsWhenDeadLetterFails(t *testing.T) {
+	filter := newTestStaleFilter(t, staleDeadLetter, &failingProducer{})
+	message := queueProducer.Message{Headers: map[string]string{"X-Request-Id": "tid_t9happe59y", "Message-Timestamp": "2015-07-06T10:00:00.000Z"}, Body: "{}"}
+
+	err := filter.process(&message)
+	assert.EqualError(t, err, "Message is 2h0m0s old and couldn't be sent to the dead letter topic: Status: 503")
+	_, dropped := err.(*stageDrop)
+	assert.False(t, dropped, "The message should count as failed rather than dropped")
+}
+
+func TestStaleFilterInvalidSettings(t *testing.T) {
+	_, err := newStaleMessageFilter(time.Hour, time.Minute, "archive", nil, newMetricsRegistry(), systemClock{})
+	assert.Error(t, err)
+
+	_, err = newStaleMessageFilter(time.Hour, time.Minute, staleDeadLetter, nil, newMetricsRegistry(), systemClock{})
+	assert.Error(t, err)
+
+	_, err = stageFactories["stale"].New(stageSettings{Stale: staleSettings{MaxAge: time.Hour, Action: staleDeadLetter, DeadLetterTopic: "StaleCmsPublicationEvents"}, Metrics: newMetricsRegistry()})
+	assert.EqualError(t, err, "-stale_action=deadletter requires -stale_dead_letter_address and -stale_dead_letter_topic")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Financial-Times/service-status-go/buildinfo"
+)
+
+type bridgeStatus struct {
+	Name        string              `json:"name"`
+	Source      sourceStatus        `json:"source"`
+	Destination destinationStatus   `json:"destination"`
+	Shadow      *shadowStatus       `json:"shadow,omitempty"`
+	Stages      []string            `json:"stages"`
+	DryRun      bool                `json:"dryRun"`
+	StartedAt   string              `json:"startedAt"`
+	Uptime      string              `json:"uptime"`
+	BuildInfo   buildinfo.BuildInfo `json:"buildInfo"`
+	Consumer    string              `json:"consumer"`
+	Workers     int                 `json:"workers"`
+	Messages    messageCounters     `json:"messages"`
+	LastError   string              `json:"lastError,omitempty"`
+}
+
+type sourceStatus struct {
+	Addresses     []string `json:"addresses"`
+	Topic         string   `json:"topic"`
+	ConsumerGroup string   `json:"consumerGroup"`
+	Offset        string   `json:"offset"`
+}
+
+type destinationStatus struct {
+	Name         string              `json:"name,omitempty"`
+	Address      string              `json:"address"`
+	ProducerType string              `json:"producerType"`
+	Topic        string              `json:"topic,omitempty"`
+	Policy       string              `json:"policy,omitempty"`
+	Destinations []destinationStatus `json:"destinations,omitempty"`
+}
+
+// multiDestinationProducer is a producer forwarding to several destinations, which it lists in the status.
+type multiDestinationProducer interface {
+	describe(status *destinationStatus)
+}
+
+type messageCounters struct {
+	Consumed  int64 `json:"consumed"`
+	Forwarded int64 `json:"forwarded"`
+	Failed    int64 `json:"failed"`
+	Stale     int64 `json:"stale"`
+	Dropped   int64 `json:"dropped"`
+	DryRun    int64 `json:"dryRun"`
+}
+
+// Status returns what the bridge is configured to do and what it has done since it started. Credentials are never included.
+func (bridge BridgeApp) Status(w http.ResponseWriter, r *http.Request) {
+	status := bridgeStatus{
+		Name: bridge.serviceName,
+		Source: sourceStatus{
+			Topic:         bridge.consumerConfig.Topic,
+			ConsumerGroup: bridge.consumerConfig.Group,
+			Offset:        bridge.consumerConfig.Offset,
+		},
+		Destination: destinationStatus{
+			Address:      redactURL(bridge.producerConfig.Addr),
+			ProducerType: bridge.producerType,
+		},
+		Stages:    bridge.pipeline.names(),
+		DryRun:    bridge.dryRun,
+		StartedAt: formatTime(bridge.started),
+		Uptime:    time.Since(bridge.started).Truncate(time.Second).String(),
+		BuildInfo: buildinfo.GetBuildInfo(),
+		Consumer:  bridge.liveness.state(),
+		Workers:   bridge.workerCount,
+		Messages: messageCounters{
+			Consumed:  bridge.metrics.counter(consumedMessagesMetric).Count(),
+			Forwarded: bridge.metrics.counter(forwardedMessagesMetric).Count(),
+			Failed:    bridge.metrics.counter(failedMessagesMetric).Count(),
+			Stale:     bridge.metrics.counter(staleMessagesMetric).Count(),
+			Dropped:   bridge.metrics.counter(droppedMessagesMetric).Count(),
+			DryRun:    bridge.metrics.counter(dryRunMessagesMetric).Count(),
+		},
+	}
+	for _, addr := range bridge.consumerConfig.Addrs {
+		status.Source.Addresses = append(status.Source.Addresses, redactURL(addr))
+	}
+	if bridge.producerType == proxy {
+		status.Destination.Topic = bridge.producerConfig.Topic
+	}
+	producerInstance := bridge.producerInstance
+	if shadow, ok := producerInstance.(*shadowProducer); ok {
+		status.Shadow = shadow.status()
+		producerInstance = shadow.primary
+	}
+	if multi, ok := producerInstance.(multiDestinationProducer); ok {
+		multi.describe(&status.Destination)
+	}
+	if bridge.errorRate != nil {
+		status.LastError = bridge.errorRate.lastError()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// redactURL removes the user info and the query of an address, as they may hold credentials.
+func redactURL(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "<invalid address>"
+	}
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "redacted"
+	}
+	return u.String()
+}
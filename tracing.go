@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceparentHeader carries the W3C trace context, both in the forwarded messages and in the plainHTTP requests.
+const traceparentHeader = "traceparent"
+
+// Span attribute keys.
+const (
+	tidAttribute          = "ft.tid"
+	uuidAttribute         = "ft.uuid"
+	topicAttribute        = "messaging.destination.name"
+	producerTypeAttribute = "kafka_bridge.producer_type"
+	outcomeAttribute      = "kafka_bridge.outcome"
+)
+
+type traceID [16]byte
+
+type spanID [8]byte
+
+// traceContext identifies a span across services, see https://www.w3.org/TR/trace-context/.
+type traceContext struct {
+	traceID traceID
+	spanID  spanID
+	sampled bool
+}
+
+// parseTraceparent reads a version 00 traceparent header, which has exactly 4 fields. Invalid headers are ignored, so that
+// a broken upstream starts a new trace.
+func parseTraceparent(header string) (traceContext, bool) {
+	tc := traceContext{}
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return tc, false
+	}
+	if _, err := hex.Decode(tc.traceID[:], []byte(parts[1])); err != nil || tc.traceID == (traceID{}) {
+		return tc, false
+	}
+	if _, err := hex.Decode(tc.spanID[:], []byte(parts[2])); err != nil || tc.spanID == (spanID{}) {
+		return tc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return tc, false
+	}
+	tc.sampled = flags[0]&1 == 1
+	return tc, true
+}
+
+func (tc traceContext) traceparent() string {
+	flags := "00"
+	if tc.sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(tc.traceID[:]), hex.EncodeToString(tc.spanID[:]), flags)
+}
+
+// span is a timed operation of the bridge. It is exported when it ends.
+type span struct {
+	name       string
+	context    traceContext
+	parent     spanID
+	start      time.Time
+	end        time.Time
+	mutex      sync.Mutex
+	attributes map[string]string
+	err        error
+	exporter   spanExporter
+	clock      clock
+}
+
+type spanExporter interface {
+	export(s *span)
+}
+
+// tracer starts the spans of the bridge. A nil tracer starts no spans, and the methods of a nil span do nothing.
+type tracer struct {
+	exporter spanExporter
+	clock    clock
+}
+
+func newTracer(exporter spanExporter, clock clock) *tracer {
+	return &tracer{exporter: exporter, clock: clock}
+}
+
+// startSpan starts a span continuing the trace of the traceparent, or a new trace when it is empty or invalid.
+func (t *tracer) startSpan(name string, traceparent string) *span {
+	return t.startSpanAt(name, traceparent, time.Time{})
+}
+
+// startSpanAt starts a span which began at the given time, e.g. when the message was consumed, or now if it is zero.
+func (t *tracer) startSpanAt(name string, traceparent string, start time.Time) *span {
+	if t == nil {
+		return nil
+	}
+	if start.IsZero() {
+		start = t.clock.now()
+	}
+	s := &span{
+		name:       name,
+		start:      start,
+		attributes: map[string]string{},
+		exporter:   t.exporter,
+		clock:      t.clock,
+	}
+	if parent, ok := parseTraceparent(traceparent); ok {
+		s.context.traceID = parent.traceID
+		s.context.sampled = parent.sampled
+		s.parent = parent.spanID
+	} else {
+		rand.Read(s.context.traceID[:])
+		s.context.sampled = true
+	}
+	rand.Read(s.context.spanID[:])
+	return s
+}
+
+func (s *span) setAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attributes[key] = value
+}
+
+func (s *span) setError(err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.err = err
+}
+
+// traceparent returns the header propagating the span to the destination, or an empty string for a nil span.
+func (s *span) traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return s.context.traceparent()
+}
+
+// finish ends the span and hands it over to the exporter, unless the trace isn't sampled.
+func (s *span) finish() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	s.end = s.clock.now()
+	s.mutex.Unlock()
+	if s.context.sampled {
+		s.exporter.export(s)
+	}
+}
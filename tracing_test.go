@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+	queueConsumer "github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingExporter struct {
+	mutex sync.Mutex
+	spans []*span
+}
+
+func (e *recordingExporter) export(s *span) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+type failingProducer struct {
+	mockProducerInstance
+}
+
+func (p *failingProducer) SendMessage(uuid string, message queueProducer.Message) error {
+	return errors.New("Status: 503")
+}
+
+func TestParseTraceparent(t *testing.T) {
+	var tests = []struct {
+		header  string
+		valid   bool
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"", false, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bz-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+	}
+
+	for _, test := range tests {
+		tc, valid := parseTraceparent(test.header)
+		assert.Equal(t, test.valid, valid, test.header)
+		if valid {
+			assert.Equal(t, test.sampled, tc.sampled, test.header)
+			assert.Equal(t, test.header, tc.traceparent())
+		}
+	}
+}
+
+func TestSpanContinuesIncomingTrace(t *testing.T) {
+	exporter := &recordingExporter{}
+	s := newTracer(exporter, systemClock{}).startSpan("forward", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	propagated, valid := parseTraceparent(s.traceparent())
+	assert.True(t, valid)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", toOTLPSpan(s).TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", toOTLPSpan(s).ParentSpanID)
+	assert.NotEqual(t, spanID{}, propagated.spanID)
+	assert.NotEqual(t, s.parent, propagated.spanID, "The destination should see the bridge span as its parent")
+
+	s.finish()
+	assert.Len(t, exporter.spans, 1)
+}
+
+func TestSpanOfUnsampledTraceIsNotExported(t *testing.T) {
+	exporter := &recordingExporter{}
+	newTracer(exporter, systemClock{}).startSpan("forward", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00").finish()
+	assert.Empty(t, exporter.spans)
+}
+
+func TestNilTracerStartsNoSpans(t *testing.T) {
+	var noTracer *tracer
+	s := noTracer.startSpan("forward", "")
+	assert.Nil(t, s)
+
+	s.setAttribute(tidAttribute, "tid_t9happe59y")
+	s.setError(errors.New("Status: 503"))
+	assert.Equal(t, "", s.traceparent())
+	s.finish()
+}
+
+func TestForwardMsgIsTraced(t *testing.T) {
+	exporter := &recordingExporter{}
+	destination := &recordingProducer{}
+	bridge := BridgeApp{
+		consumerConfig:   &queueConsumer.QueueConfig{Topic: "NativeCmsPublicationEvents"},
+		producerInstance: destination,
+		producerType:     proxy,
+		metrics:          newMetricsRegistry(),
+		tracer:           newTracer(exporter, systemClock{}),
+	}
+
+	bridge.forwardMsg(consumedMessage{Message: queueConsumer.Message{
+		Headers: map[string]string{
+			"X-Request-Id":    "tid_t9happe59y",
+			traceparentHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		Body: `{"uuid":"7543220a-2389-11e5-bd83-71cb60e8f08c"}`,
+	}})
+
+	assert.Len(t, exporter.spans, 1)
+	s := toOTLPSpan(exporter.spans[0])
+	assert.Equal(t, "forward NativeCmsPublicationEvents", s.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s.TraceID)
+	assert.Equal(t, otlpStatusOK, s.Status.Code)
+	assert.Equal(t, []otlpAttribute{
+		{Key: tidAttribute, Value: otlpValue{StringValue: "tid_t9happe59y"}},
+		{Key: uuidAttribute, Value: otlpValue{StringValue: "7543220a-2389-11e5-bd83-71cb60e8f08c"}},
+		{Key: outcomeAttribute, Value: otlpValue{StringValue: "forwarded"}},
+		{Key: producerTypeAttribute, Value: otlpValue{StringValue: proxy}},
+		{Key: topicAttribute, Value: otlpValue{StringValue: "NativeCmsPublicationEvents"}},
+	}, s.Attributes)
+
+	assert.Len(t, destination.messages, 1)
+	assert.Equal(t, exporter.spans[0].traceparent(), destination.messages[0].Headers[traceparentHeader])
+}
+
+func TestForwardSpanStartsWhenMessageIsConsumed(t *testing.T) {
+	exporter := &recordingExporter{}
+	bridge := BridgeApp{
+		consumerConfig:   &queueConsumer.QueueConfig{Topic: "NativeCmsPublicationEvents"},
+		producerInstance: &recordingProducer{},
+		producerType:     proxy,
+		metrics:          newMetricsRegistry(),
+		tracer:           newTracer(exporter, systemClock{}),
+	}
+
+	consumed := time.Now().Add(-time.Second)
+	bridge.forwardMsg(consumedMessage{Message: queueConsumer.Message{Headers: map[string]string{"X-Request-Id": "tid_t9happe59y"}, Body: "{}"}, consumed: consumed})
+
+	assert.Len(t, exporter.spans, 1)
+	assert.Equal(t, consumed, exporter.spans[0].start, "The span covers the time the message was queued")
+	assert.True(t, exporter.spans[0].end.Sub(exporter.spans[0].start) >= time.Second)
+}
+
+func TestForwardMsgFailureIsRecordedOnSpan(t *testing.T) {
+	exporter := &recordingExporter{}
+	bridge := BridgeApp{
+		consumerConfig:   &queueConsumer.QueueConfig{Topic: "NativeCmsPublicationEvents"},
+		producerInstance: &failingProducer{},
+		producerType:     plainHTTP,
+		metrics:          newMetricsRegistry(),
+		tracer:           newTracer(exporter, systemClock{}),
+	}
+
+	bridge.forwardMsg(consumedMessage{Message: queueConsumer.Message{Headers: map[string]string{"X-Request-Id": "tid_t9happe59y"}, Body: "{}"}})
+
+	assert.Len(t, exporter.spans, 1)
+	s := toOTLPSpan(exporter.spans[0])
+	assert.Equal(t, otlpStatusError, s.Status.Code)
+	assert.Equal(t, "Status: 503", s.Status.Message)
+	assert.Empty(t, s.ParentSpanID, "A message without traceparent starts a new trace")
+}
+
+func TestPlainHTTPProducerPropagatesTraceparent(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(traceparentHeader)
+	}))
+	defer server.Close()
+
+	producer := newPlainHTTPMessageProducer(queueProducer.MessageProducerConfig{Addr: server.URL})
+	err := producer.SendMessage("", queueProducer.Message{
+		Headers: map[string]string{
+			"X-Request-Id":     "tid_t9happe59y",
+			"Origin-System-Id": "http://cmdb.ft.com/systems/methode-web-pub",
+			traceparentHeader:  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		Body: "{}",
+	})
+	assert.NoError(t, err)
+
+	select {
+	case traceparent := <-received:
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", traceparent)
+	case <-time.After(time.Second):
+		t.Fatal("Request was not received")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+	"go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+)
+
+const transformFunction = "transform"
+
+// transformSettings configures the transform stage. It is disabled without a script.
+type transformSettings struct {
+	Script   string
+	Timeout  time.Duration
+	MaxSteps uint64
+}
+
+// transformStage runs every message through the transform function of a Starlark script. The function receives a dict
+// with the headers and the body of the message and returns it, changed or not, or None to drop the message. The
+// X-Request-Id header set by the tid stage can't be changed.
+// Scripts can't load modules nor reach the file system or the network, and every call is cancelled when it runs out of
+// time or execution steps.
+type transformStage struct {
+	transform starlark.Callable
+	timeout   time.Duration
+	maxSteps  uint64
+	dropped   *counter
+}
+
+func init() {
+	registerStage(stageFactory{
+		Name:        "transform",
+		Description: "Rewrites or drops messages with the transform(message) function of the Starlark script -transform_script. It does nothing when -transform_script isn't set.",
+		New: func(settings stageSettings) (messageStage, error) {
+			if settings.Transform.Script == "" {
+				return nil, nil
+			}
+			src, err := ioutil.ReadFile(settings.Transform.Script)
+			if err != nil {
+				return nil, err
+			}
+			return newTransformStage(settings.Transform.Script, src, settings.Transform.Timeout, settings.Transform.MaxSteps, settings.Metrics)
+		},
+	})
+}
+
+func newTransformStage(filename string, src []byte, timeout time.Duration, maxSteps uint64, metrics *metricsRegistry) (*transformStage, error) {
+	if timeout <= 0 {
+		return nil, fmt.Errorf("-transform_timeout should be positive, got %v", timeout)
+	}
+	if maxSteps == 0 {
+		return nil, errors.New("-transform_max_steps should be positive, got 0")
+	}
+	s := &transformStage{timeout: timeout, maxSteps: maxSteps, dropped: metrics.counter(droppedMessagesMetric)}
+	thread := s.newThread("")
+	defer s.cancelAfterTimeout(thread).Stop()
+
+	globals, err := starlark.ExecFile(thread, filename, src, starlark.StringDict{"json": json.Module})
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't load the transform script: %v", err.Error())
+	}
+	// The workers run transform concurrently, so the globals of the script are made read-only: a script keeping state
+	// in them fails instead of racing.
+	globals.Freeze()
+	transform, ok := globals[transformFunction].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("The transform script should define a %s(message) function", transformFunction)
+	}
+	s.transform = transform
+	return s, nil
+}
+
+// newThread returns the thread a script runs in, logging what it prints against the TID of the message, if any.
+func (s *transformStage) newThread(tid string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: "transform",
+		Print: func(thread *starlark.Thread, msg string) {
+			if tid == "" {
+				logger.Infof(nil, "Transform script: %s", msg)
+				return
+			}
+			logger.NewEntry(tid).Info("Transform script: " + msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(s.maxSteps)
+	return thread
+}
+
+func (s *transformStage) cancelAfterTimeout(thread *starlark.Thread) *time.Timer {
+	return time.AfterFunc(s.timeout, func() {
+		thread.Cancel(fmt.Sprintf("transform took longer than %v", s.timeout))
+	})
+}
+
+func (s *transformStage) process(message *queueProducer.Message) error {
+	tid := message.Headers["X-Request-Id"]
+	thread := s.newThread(tid)
+	defer s.cancelAfterTimeout(thread).Stop()
+
+	result, err := starlark.Call(thread, s.transform, starlark.Tuple{toStarlarkMessage(*message)}, nil)
+	if err != nil {
+		return err
+	}
+	if result == starlark.None {
+		logger.NewEntry(tid).Info("Message was dropped by the transform script.")
+		s.dropped.Inc()
+		return &stageDrop{outcome: "dropped"}
+	}
+	transformed, err := fromStarlarkMessage(result)
+	if err != nil {
+		return err
+	}
+	if transformed.Headers["X-Request-Id"] != tid {
+		return fmt.Errorf("%s shouldn't change the X-Request-Id header, it returned '%s'", transformFunction, transformed.Headers["X-Request-Id"])
+	}
+	*message = transformed
+	return nil
+}
+
+func toStarlarkMessage(message queueProducer.Message) *starlark.Dict {
+	headers := starlark.NewDict(len(message.Headers))
+	for key, value := range message.Headers {
+		headers.SetKey(starlark.String(key), starlark.String(value))
+	}
+	dict := starlark.NewDict(2)
+	dict.SetKey(starlark.String("headers"), headers)
+	dict.SetKey(starlark.String("body"), starlark.String(message.Body))
+	return dict
+}
+
+// fromStarlarkMessage reads the message returned by the transform function, a dict with a headers dict of strings and a string body.
+func fromStarlarkMessage(value starlark.Value) (queueProducer.Message, error) {
+	message := queueProducer.Message{Headers: map[string]string{}}
+	dict, ok := value.(*starlark.Dict)
+	if !ok {
+		return message, fmt.Errorf("%s should return a dict with the headers and the body of the message, or None to drop it, got %s", transformFunction, value.Type())
+	}
+
+	headers, _, _ := dict.Get(starlark.String("headers"))
+	headersDict, ok := headers.(*starlark.Dict)
+	if !ok {
+		return message, fmt.Errorf("The headers returned by %s should be a dict", transformFunction)
+	}
+	for _, item := range headersDict.Items() {
+		key, keyOK := starlark.AsString(item[0])
+		value, valueOK := starlark.AsString(item[1])
+		if !keyOK || !valueOK {
+			return message, fmt.Errorf("The headers returned by %s should be strings, got %s: %s", transformFunction, item[0], item[1])
+		}
+		message.Headers[key] = value
+	}
+
+	body, _, _ := dict.Get(starlark.String("body"))
+	bodyString, ok := starlark.AsString(body)
+	if !ok {
+		return message, fmt.Errorf("The body returned by %s should be a string", transformFunction)
+	}
+	message.Body = bodyString
+	return message, nil
+}
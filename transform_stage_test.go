@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	queueProducer "github.com/Financial-Times/message-queue-go-producer/producer"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTransformScript = `
+def transform(message):
+    headers = message["headers"]
+    if headers.get("Message-Type") == "cms-content-deleted":
+        return None
+    body = json.decode(message["body"])
+    body["value"] = body["value"].upper()
+    headers["X-Transformed"] = "true"
+    return {"headers": headers, "body": json.encode(body)}
+`
+
+func newTestTransformStage(t *testing.T, script string) *transformStage {
+	stage, err := newTransformStage("transform.star", []byte(script), time.Second, 100000, newMetricsRegistry())
+	assert.NoError(t, err)
+	return stage
+}
+
+func TestTransformStage(t *testing.T) {
+	stage := newTestTransformStage(t, testTransformScript)
+	message := &queueProducer.Message{
+		Headers: map[string]string{"X-Request-Id": "tid_t9happe59y", "Message-Type": "cms-content-published"},
+		Body:    `{"uuid":"7543220a-2389-11e5-bd83-71cb60e8f08c","value":"test"}`,
+	}
+
+	assert.NoError(t, stage.process(message))
+	assert.Equal(t, map[string]string{"X-Request-Id": "tid_t9happe59y", "Message-Type": "cms-content-published", "X-Transformed": "true"}, message.Headers)
+	assert.Equal(t, `{"uuid":"7543220a-2389-11e5-bd83-71cb60e8f08c","value":"TEST"}`, message.Body)
+}
+
+func TestTransformStageDropsMessage(t *testing.T) {
+	stage := newTestTransformStage(t, testTransformScript)
+	message := &queueProducer.Message{Headers: map[string]string{"X-Request-Id": "tid_t9happe59y", "Message-Type": "cms-content-deleted"}, Body: "{}"}
+
+	err := stage.process(message)
+	assert.IsType(t, &stageDrop{}, err)
+	assert.Equal(t, int64(1), stage.dropped.Count())
+}
+
+func TestTransformStageFailures(t *testing.T) {
+	var tests = []struct {
+		script        string
+		expectedError string
+	}{
+		{"def transform(message):\n    return 1\n", "transform should return a dict with the headers and the body of the message, or None to drop it, got int"},
+		{"def transform(message):\n    return {\"body\": \"{}\"}\n", "The headers returned by transform should be a dict"},
+		{"def transform(message):\n    return {\"headers\": {\"X-Request-Id\": 1}, \"body\": \"{}\"}\n", `The headers returned by transform should be strings, got "X-Request-Id": 1`},
+		{"def transform(message):\n    return {\"headers\": {}, \"body\": None}\n", "The body returned by transform should be a string"},
+		{"def transform(message):\n    fail(\"unexpected body\")\n", "fail: unexpected body"},
+		{"def transform(message):\n    return {\"headers\": {}, \"body\": \"{}\"}\n", "transform shouldn't change the X-Request-Id header, it returned ''"},
+		{"def transform(message):\n    return {\"headers\": {\"X-Request-Id\": \"tid_other\"}, \"body\": \"{}\"}\n", "transform shouldn't change the X-Request-Id header, it returned 'tid_other'"},
+		{"def transform(message):\n    for i in range(1000000):\n        pass\n    return message\n", "Starlark computation cancelled: too many steps"},
+		{"seen = []\ndef transform(message):\n    seen.append(message)\n    return message\n", "append: cannot append to frozen list"},
+	}
+
+	for _, test := range tests {
+		stage := newTestTransformStage(t, test.script)
+		err := stage.process(&queueProducer.Message{Headers: map[string]string{"X-Request-Id": "tid_t9happe59y"}, Body: "{}"})
+		assert.EqualError(t, err, test.expectedError, test.script)
+	}
+}
+
+func TestTransformStageGlobalsAreFrozenAcrossWorkers(t *testing.T) {
+	stage := newTestTransformStage(t, "count = {\"messages\": 0}\ndef transform(message):\n    count[\"messages\"] += 1\n    return message\n")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- stage.process(&queueProducer.Message{Headers: map[string]string{"X-Request-Id": "tid_t9happe59y"}, Body: "{}"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.EqualError(t, err, "cannot insert into frozen hash table")
+	}
+}
+
+func TestTransformStageTimeout(t *testing.T) {
+	stage, err := newTransformStage("transform.star", []byte("def transform(message):\n    for i in range(100000000):\n        pass\n    return message\n"), 10*time.Millisecond, 1000000000, newMetricsRegistry())
+	assert.NoError(t, err)
+
+	err = stage.process(&queueProducer.Message{Headers: map[string]string{}, Body: "{}"})
+	assert.EqualError(t, err, "Starlark computation cancelled: transform took longer than 10ms")
+}
+
+func TestNewTransformStageInvalidScript(t *testing.T) {
+	var tests = []struct {
+		script        string
+		expectedError string
+	}{
+		{"def transform(message:\n", "Couldn't load the transform script: transform.star:1:23: got ':', want ')'"},
+		{"load(\"os.star\", \"system\")\n", "Couldn't load the transform script: load not implemented by this application"},
+		{"def rewrite(message):\n    return message\n", "The transform script should define a transform(message) function"},
+	}
+
+	for _, test := range tests {
+		_, err := newTransformStage("transform.star", []byte(test.script), time.Second, 100000, newMetricsRegistry())
+		assert.EqualError(t, err, test.expectedError, test.script)
+	}
+
+	_, err := newTransformStage("transform.star", []byte(testTransformScript), 0, 100000, newMetricsRegistry())
+	assert.EqualError(t, err, "-transform_timeout should be positive, got 0s")
+	_, err = newTransformStage("transform.star", []byte(testTransformScript), time.Second, 0, newMetricsRegistry())
+	assert.EqualError(t, err, "-transform_max_steps should be positive, got 0")
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Financial-Times/service-status-go/buildinfo"
+)
+
+// describeBuild summarises the build info embedded into the binary at build time, see the Dockerfile.
+func describeBuild(info buildinfo.BuildInfo) string {
+	if info.Version == "" && info.Revision == "" {
+		return "Development build."
+	}
+	return fmt.Sprintf("Version %s, revision %s, built %s.", valueOrUnknown(info.Version), valueOrUnknown(info.Revision), valueOrUnknown(info.DateTime))
+}
+
+func valueOrUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Financial-Times/service-status-go/buildinfo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeBuild(t *testing.T) {
+	var tests = []struct {
+		info     buildinfo.BuildInfo
+		expected string
+	}{
+		{buildinfo.BuildInfo{}, "Development build."},
+		{buildinfo.BuildInfo{Version: "v1.4.0", Revision: "3f2c1ab", DateTime: "20181012093000"}, "Version v1.4.0, revision 3f2c1ab, built 20181012093000."},
+		{buildinfo.BuildInfo{Revision: "3f2c1ab"}, "Version unknown, revision 3f2c1ab, built unknown."},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, describeBuild(test.info))
+	}
+}